@@ -0,0 +1,497 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"devops-autopilot/ratelimit"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets in the effective configuration
+const redacted = "[REDACTED]"
+
+// Config is the effective service configuration: defaults, then the YAML file, then environment
+// variables, then command-line flags
+type Config struct {
+	Server    ServerConfig    `yaml:"server" json:"server"`
+	Terraform TerraformConfig `yaml:"terraform" json:"terraform"`
+	Lint      LintConfig      `yaml:"lint" json:"lint"`
+	Jobs      JobsConfig      `yaml:"jobs" json:"jobs"`
+	Readiness ReadinessConfig `yaml:"readiness" json:"readiness"`
+	Auth      AuthConfig      `yaml:"auth" json:"auth"`
+	Storage   StorageConfig   `yaml:"storage" json:"storage"`
+	GitSink   GitSinkConfig   `yaml:"git_sink" json:"gitSink"`
+	Tenants   TenantsConfig   `yaml:"tenants" json:"tenants"`
+	RateLimit RateLimitConfig `yaml:"rate_limit" json:"rateLimit"`
+	Logging   LoggingConfig   `yaml:"logging" json:"logging"`
+	Tracing   TracingConfig   `yaml:"tracing" json:"tracing"`
+
+	// Reloaded without a restart
+	Providers ProvidersConfig `yaml:"providers" json:"providers"`
+	GitHub    GitHubConfig    `yaml:"github" json:"github"`
+	Prompts   PromptsConfig   `yaml:"prompts" json:"prompts"`
+	Policies  PoliciesConfig  `yaml:"policies" json:"policies"`
+	Limits    LimitsConfig    `yaml:"limits" json:"limits"`
+}
+
+// ServerConfig controls the HTTP server
+type ServerConfig struct {
+	Port                int      `yaml:"port" json:"port"`
+	ReadHeaderTimeout   Duration `yaml:"read_header_timeout" json:"readHeaderTimeout"`
+	ShutdownGracePeriod Duration `yaml:"shutdown_grace_period" json:"shutdownGracePeriod"`
+
+	// Proxy addresses or CIDRs whose X-Forwarded-For is believed; none by default, so clients
+	// are identified by the connection's address and cannot pick their own rate limit bucket
+	TrustedProxies []string `yaml:"trusted_proxies" json:"trustedProxies"`
+}
+
+// ProvidersConfig configures the LLM providers
+type ProvidersConfig struct {
+	OpenAI  ProviderConfig `yaml:"openai" json:"openai"`
+	Copilot ProviderConfig `yaml:"copilot" json:"copilot"`
+}
+
+// ProviderConfig configures one LLM provider
+type ProviderConfig struct {
+	Disabled    bool     `yaml:"disabled" json:"disabled"`                  // turn the provider off even when credentials are set
+	APIKey      string   `yaml:"api_key,omitempty" json:"apiKey,omitempty"` // OpenAI only; GitHub Models use github.token
+	BaseURL     string   `yaml:"base_url,omitempty" json:"baseUrl,omitempty"`
+	Model       string   `yaml:"model" json:"model"`
+	Timeout     Duration `yaml:"timeout" json:"timeout"`
+	MaxTokens   int      `yaml:"max_tokens" json:"maxTokens"`
+	Temperature float32  `yaml:"temperature" json:"temperature"`
+}
+
+// GitHubConfig holds the credentials used for GitHub Models, pull requests and webhooks
+type GitHubConfig struct {
+	Token         string `yaml:"token" json:"token"`
+	WebhookSecret string `yaml:"webhook_secret" json:"webhookSecret"`
+	APIURL        string `yaml:"api_url" json:"apiUrl"` // https://<host>/api/v3 for GitHub Enterprise
+
+	// Logins allowed to run ChatOps commands besides repository owners, members and collaborators
+	ChatOpsAllowedUsers []string `yaml:"chatops_allowed_users" json:"chatopsAllowedUsers"`
+
+	// owner/name repositories callers without a tenant may open pull requests against; tenants
+	// may only target their own repos
+	PullRequestRepos []string `yaml:"pull_request_repos" json:"pullRequestRepos"`
+}
+
+// TerraformConfig controls terraform runs and provider schemas
+type TerraformConfig struct {
+	PluginCacheDir  string   `yaml:"plugin_cache_dir" json:"pluginCacheDir"`
+	SchemaCacheDir  string   `yaml:"schema_cache_dir" json:"schemaCacheDir"`
+	SchemaProviders []string `yaml:"schema_providers" json:"schemaProviders"`
+}
+
+// LintConfig locates tflint rulesets and plugins
+type LintConfig struct {
+	ConfigDir string `yaml:"config_dir" json:"configDir"`
+	PluginDir string `yaml:"plugin_dir" json:"pluginDir"`
+}
+
+// JobsConfig sizes the background job queue
+type JobsConfig struct {
+	Workers     int    `yaml:"workers" json:"workers"`
+	QueueSize   int    `yaml:"queue_size" json:"queueSize"`
+	PendingFile string `yaml:"pending_file" json:"pendingFile"` // jobs not started at shutdown are saved here and run on the next start
+}
+
+// ReadinessConfig controls /readyz
+type ReadinessConfig struct {
+	ProbeProviders bool `yaml:"probe_providers" json:"probeProviders"`
+}
+
+// AuthConfig locates API keys and JWT verification keys
+type AuthConfig struct {
+	// Run without credentials, making every caller an anonymous admin; for local development only
+	Disabled       bool   `yaml:"disabled" json:"disabled"`
+	APIKeysFile    string `yaml:"api_keys_file" json:"apiKeysFile"`
+	JWKSFile       string `yaml:"jwks_file" json:"jwksFile"`
+	JWTIssuer      string `yaml:"jwt_issuer" json:"jwtIssuer"`
+	JWTAudience    string `yaml:"jwt_audience" json:"jwtAudience"`
+	JWTRolesClaim  string `yaml:"jwt_roles_claim" json:"jwtRolesClaim"`
+	JWTTenantClaim string `yaml:"jwt_tenant_claim" json:"jwtTenantClaim"`
+}
+
+// StorageConfig selects the artifact storage backend: filesystem, s3 or sqlite
+type StorageConfig struct {
+	Backend       string              `yaml:"backend" json:"backend"`
+	Dir           string              `yaml:"dir" json:"dir"`
+	QuarantineDir string              `yaml:"quarantine_dir" json:"quarantineDir"`
+	S3            S3StorageConfig     `yaml:"s3" json:"s3"`
+	SQLite        SQLiteStorageConfig `yaml:"sqlite" json:"sqlite"`
+}
+
+// S3StorageConfig configures an S3-compatible bucket
+type S3StorageConfig struct {
+	Endpoint        string `yaml:"endpoint" json:"endpoint"` // host[:port]
+	Bucket          string `yaml:"bucket" json:"bucket"`
+	Prefix          string `yaml:"prefix" json:"prefix"`
+	Region          string `yaml:"region" json:"region"`
+	AccessKeyID     string `yaml:"access_key_id" json:"accessKeyId"`
+	SecretAccessKey string `yaml:"secret_access_key" json:"secretAccessKey"`
+	UseSSL          bool   `yaml:"use_ssl" json:"useSsl"`
+}
+
+// SQLiteStorageConfig locates the SQLite databases; tenants get <path>-<tenant>.db
+type SQLiteStorageConfig struct {
+	Path           string `yaml:"path" json:"path"`
+	QuarantinePath string `yaml:"quarantine_path" json:"quarantinePath"`
+}
+
+// GitSinkConfig commits saved generations to a local git repository when Repo is set
+type GitSinkConfig struct {
+	Repo        string `yaml:"repo" json:"repo"`
+	BaseBranch  string `yaml:"base_branch" json:"baseBranch"`
+	Path        string `yaml:"path" json:"path"`
+	AuthorName  string `yaml:"author_name" json:"authorName"`
+	AuthorEmail string `yaml:"author_email" json:"authorEmail"`
+}
+
+// TenantsConfig locates the tenant definitions and usage counters
+type TenantsConfig struct {
+	File      string `yaml:"file" json:"file"`
+	UsageFile string `yaml:"usage_file" json:"usageFile"`
+}
+
+// RateLimitConfig selects where rate limit buckets are kept
+type RateLimitConfig struct {
+	RedisURL string `yaml:"redis_url" json:"redisUrl"` // shares buckets between replicas; process memory when empty
+}
+
+// LoggingConfig controls log output
+type LoggingConfig struct {
+	Level         string `yaml:"level" json:"level"`                  // debug, info, warn or error
+	Format        string `yaml:"format" json:"format"`                // json or text
+	RedactPattern string `yaml:"redact_pattern" json:"redactPattern"` // regular expression for further values to scrub
+}
+
+// TracingConfig selects the span exporter: otlp (configured with the standard
+// OTEL_EXPORTER_OTLP_* variables), console or none
+type TracingConfig struct {
+	Exporter string `yaml:"exporter" json:"exporter"`
+}
+
+// PromptsConfig overrides the built-in generation prompts. Templates use text/template with
+// {{.Resource}} and {{.Specs}}.
+type PromptsConfig struct {
+	OpenAI      string `yaml:"openai" json:"openai"`
+	Copilot     string `yaml:"copilot" json:"copilot"`
+	Version     string `yaml:"version" json:"version"`         // recorded in provenance for custom templates
+	Conventions string `yaml:"conventions" json:"conventions"` // house conventions for every generation
+}
+
+// PoliciesConfig decides how generated and submitted code is checked
+type PoliciesConfig struct {
+	RequireLint             bool   `yaml:"require_lint" json:"requireLint"`
+	DefaultLintRuleset      string `yaml:"default_lint_ruleset" json:"defaultLintRuleset"`
+	QuarantineRetentionDays int    `yaml:"quarantine_retention_days" json:"quarantineRetentionDays"`
+}
+
+// LimitsConfig holds per-client rate limits such as "10/m" or "off" (see ratelimit.ParseLimit)
+type LimitsConfig struct {
+	Terraform        string `yaml:"terraform" json:"terraform"`
+	TerraformCopilot string `yaml:"terraform_copilot" json:"terraformCopilot"`
+	Validate         string `yaml:"validate" json:"validate"`
+}
+
+// Duration is a time.Duration written as a string such as "30s" in YAML and JSON
+type Duration time.Duration
+
+// Std returns the duration as a time.Duration
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// String implements fmt.Stringer
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q", node.Line, node.Value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Defaults returns the configuration used when nothing overrides it
+func Defaults() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:                5000,
+			ReadHeaderTimeout:   Duration(10 * time.Second),
+			ShutdownGracePeriod: Duration(25 * time.Second), // below the 30s Kubernetes gives a pod
+		},
+		Providers: ProvidersConfig{
+			OpenAI: ProviderConfig{
+				Model:       "gpt-3.5-turbo",
+				Timeout:     Duration(30 * time.Second),
+				MaxTokens:   2000,
+				Temperature: 0.2,
+			},
+			Copilot: ProviderConfig{
+				BaseURL:     "https://models.inference.ai.azure.com",
+				Model:       "gpt-4o-mini",
+				Timeout:     Duration(30 * time.Second),
+				MaxTokens:   2000,
+				Temperature: 0.2,
+			},
+		},
+		GitHub:    GitHubConfig{APIURL: "https://api.github.com"},
+		Terraform: TerraformConfig{SchemaCacheDir: ".terraform-schema-cache"},
+		Lint:      LintConfig{ConfigDir: "tflint-rulesets"},
+		Jobs:      JobsConfig{Workers: 2, QueueSize: 100, PendingFile: "pending-jobs.json"},
+		Auth:      AuthConfig{JWTRolesClaim: "roles", JWTTenantClaim: "tenant"},
+		Storage: StorageConfig{
+			Backend:       "filesystem",
+			Dir:           "tf-generated-files",
+			QuarantineDir: "tf-quarantine",
+			S3:            S3StorageConfig{UseSSL: true},
+			SQLite:        SQLiteStorageConfig{Path: "autopilot.db", QuarantinePath: "autopilot-quarantine.db"},
+		},
+		GitSink: GitSinkConfig{
+			BaseBranch:  "main",
+			Path:        "generated",
+			AuthorName:  "DevOps Autopilot",
+			AuthorEmail: "autopilot@localhost",
+		},
+		Tenants: TenantsConfig{File: "tenants.json", UsageFile: "tenant-usage.json"},
+		Logging: LoggingConfig{Level: "info", Format: "json"},
+		Tracing: TracingConfig{Exporter: "none"},
+		Policies: PoliciesConfig{
+			DefaultLintRuleset:      "default",
+			QuarantineRetentionDays: 30,
+		},
+		Limits: LimitsConfig{
+			Terraform:        "10/m",
+			TerraformCopilot: "10/m",
+			Validate:         "60/m",
+		},
+	}
+}
+
+// normalize lowercases enumerated settings and maps their aliases to the canonical names
+func (c *Config) normalize() {
+	c.Storage.Backend = strings.ToLower(strings.TrimSpace(c.Storage.Backend))
+	if c.Storage.Backend == "" || c.Storage.Backend == "fs" || c.Storage.Backend == "local" {
+		c.Storage.Backend = "filesystem"
+	}
+	c.Logging.Level = strings.ToLower(strings.TrimSpace(c.Logging.Level))
+	if c.Logging.Level == "warning" {
+		c.Logging.Level = "warn"
+	}
+	c.Logging.Format = strings.ToLower(strings.TrimSpace(c.Logging.Format))
+	c.Tracing.Exporter = strings.ToLower(strings.TrimSpace(c.Tracing.Exporter))
+	switch c.Tracing.Exporter {
+	case "":
+		c.Tracing.Exporter = "none"
+	case "stdout":
+		c.Tracing.Exporter = "console"
+	}
+}
+
+// Validate checks that every setting is usable, reporting all problems at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout must be positive")
+	check(c.Server.ShutdownGracePeriod >= 0, "server.shutdown_grace_period must not be negative")
+
+	providers := []struct {
+		name string
+		ProviderConfig
+	}{{"openai", c.Providers.OpenAI}, {"copilot", c.Providers.Copilot}}
+	for _, provider := range providers {
+		name := provider.name
+		check(strings.TrimSpace(provider.Model) != "", "providers.%s.model must be set", name)
+		check(provider.Timeout > 0, "providers.%s.timeout must be positive", name)
+		check(provider.MaxTokens > 0, "providers.%s.max_tokens must be positive, got %d", name, provider.MaxTokens)
+		check(provider.Temperature >= 0 && provider.Temperature <= 2, "providers.%s.temperature must be between 0 and 2, got %g", name, provider.Temperature)
+	}
+	// The OpenAI client omits a zero temperature from requests, so the API would use its default of 1
+	check(c.Providers.OpenAI.Temperature != 0, "providers.openai.temperature cannot be 0 (the API would use its default of 1); use a small value such as 0.01")
+	check(strings.HasPrefix(c.Providers.Copilot.BaseURL, "https://") || strings.HasPrefix(c.Providers.Copilot.BaseURL, "http://"),
+		"providers.copilot.base_url must be an http(s) URL, got %q", c.Providers.Copilot.BaseURL)
+
+	check(strings.HasPrefix(c.GitHub.APIURL, "https://") || strings.HasPrefix(c.GitHub.APIURL, "http://"),
+		"github.api_url must be an http(s) URL, got %q", c.GitHub.APIURL)
+
+	check(c.Lint.ConfigDir != "", "lint.config_dir must be set")
+	check(c.Terraform.SchemaCacheDir != "", "terraform.schema_cache_dir must be set")
+	check(c.Jobs.Workers > 0, "jobs.workers must be positive, got %d", c.Jobs.Workers)
+	check(c.Jobs.QueueSize > 0, "jobs.queue_size must be positive, got %d", c.Jobs.QueueSize)
+
+	check(c.Auth.JWTRolesClaim != "" && c.Auth.JWTTenantClaim != "", "auth.jwt_roles_claim and auth.jwt_tenant_claim must be set")
+
+	switch c.Storage.Backend {
+	case "filesystem":
+		check(c.Storage.Dir != "" && c.Storage.QuarantineDir != "", "storage.dir and storage.quarantine_dir must be set")
+	case "s3":
+		check(c.Storage.S3.Endpoint != "", "storage.s3.endpoint must be set for the s3 backend")
+		check(c.Storage.S3.Bucket != "", "storage.s3.bucket must be set for the s3 backend")
+	case "sqlite":
+		check(c.Storage.SQLite.Path != "" && c.Storage.SQLite.QuarantinePath != "", "storage.sqlite.path and storage.sqlite.quarantine_path must be set")
+	default:
+		check(false, "storage.backend must be filesystem, s3 or sqlite, got %q", c.Storage.Backend)
+	}
+
+	if c.GitSink.Repo != "" {
+		check(c.GitSink.BaseBranch != "", "git_sink.base_branch must be set")
+		check(c.GitSink.AuthorName != "" && c.GitSink.AuthorEmail != "", "git_sink.author_name and git_sink.author_email must be set")
+		for _, segment := range strings.Split(c.GitSink.Path, "/") {
+			check(segment != "" && !strings.HasPrefix(segment, "."), "git_sink.path must be a relative path without empty, \"..\" or hidden segments, got %q", c.GitSink.Path)
+		}
+	}
+
+	check(c.Tenants.File != "" && c.Tenants.UsageFile != "", "tenants.file and tenants.usage_file must be set")
+
+	if c.RateLimit.RedisURL != "" {
+		parsed, err := url.Parse(c.RateLimit.RedisURL)
+		check(err == nil && (parsed.Scheme == "redis" || parsed.Scheme == "rediss"), "rate_limit.redis_url must be a redis:// or rediss:// URL")
+	}
+
+	check(slices.Contains([]string{"debug", "info", "warn", "error"}, c.Logging.Level), "logging.level must be debug, info, warn or error, got %q", c.Logging.Level)
+	check(c.Logging.Format == "json" || c.Logging.Format == "text", "logging.format must be json or text, got %q", c.Logging.Format)
+	if c.Logging.RedactPattern != "" {
+		_, err := regexp.Compile(c.Logging.RedactPattern)
+		check(err == nil, "logging.redact_pattern is not a valid regular expression: %v", err)
+	}
+	check(slices.Contains([]string{"none", "otlp", "console"}, c.Tracing.Exporter), "tracing.exporter must be otlp, console or none, got %q", c.Tracing.Exporter)
+
+	for _, prompt := range [][2]string{{"openai", c.Prompts.OpenAI}, {"copilot", c.Prompts.Copilot}} {
+		if prompt[1] != "" {
+			_, err := template.New(prompt[0]).Parse(prompt[1])
+			check(err == nil, "prompts.%s is not a valid template: %v", prompt[0], err)
+		}
+	}
+
+	check(c.Policies.DefaultLintRuleset != "", "policies.default_lint_ruleset must be set")
+	check(c.Policies.QuarantineRetentionDays >= 0, "policies.quarantine_retention_days must not be negative")
+
+	for _, limit := range [][2]string{{"terraform", c.Limits.Terraform}, {"terraform_copilot", c.Limits.TerraformCopilot}, {"validate", c.Limits.Validate}} {
+		_, _, err := ratelimit.ParseLimit(limit[1])
+		check(err == nil, "limits.%s: %v", limit[0], err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy with credentials replaced, safe to return from the API
+func (c *Config) Redacted() *Config {
+	copied := *c
+	for _, secret := range copied.secretFields() {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	return &copied
+}
+
+// Secrets returns the configured credentials, for log redaction. The password of the Redis URL
+// is included on its own too, since clients may log the URL in another form.
+func (c *Config) Secrets() []string {
+	secrets := []string{}
+	for _, secret := range c.secretFields() {
+		secrets = append(secrets, *secret)
+	}
+	if parsed, err := url.Parse(c.RateLimit.RedisURL); err == nil && parsed.User != nil {
+		if password, ok := parsed.User.Password(); ok {
+			secrets = append(secrets, password)
+		}
+	}
+	return secrets
+}
+
+// secretFields returns pointers to every credential setting
+func (c *Config) secretFields() []*string {
+	return []*string{
+		&c.Providers.OpenAI.APIKey,
+		&c.GitHub.Token,
+		&c.GitHub.WebhookSecret,
+		&c.Storage.S3.AccessKeyID,
+		&c.Storage.S3.SecretAccessKey,
+		&c.RateLimit.RedisURL,
+	}
+}
+
+// RateLimit returns the per-client limit for a route by name; ok is false when it is disabled
+func (l LimitsConfig) RateLimit(name string) (limit ratelimit.Limit, ok bool) {
+	var value string
+	switch name {
+	case "terraform":
+		value = l.Terraform
+	case "terraform-copilot":
+		value = l.TerraformCopilot
+	case "validate":
+		value = l.Validate
+	default:
+		return ratelimit.Limit{}, false
+	}
+	// Limits were validated when loaded
+	limit, ok, _ = ratelimit.ParseLimit(value)
+	return limit, ok
+}
+
+// Get returns the settings of a provider by name ("openai" or "copilot")
+func (p ProvidersConfig) Get(name string) (ProviderConfig, bool) {
+	switch name {
+	case "openai":
+		return p.OpenAI, true
+	case "copilot":
+		return p.Copilot, true
+	default:
+		return ProviderConfig{}, false
+	}
+}
+
+// QuarantineRetention returns how long quarantined generations are kept; 0 keeps them forever
+func (p PoliciesConfig) QuarantineRetention() time.Duration {
+	return time.Duration(p.QuarantineRetentionDays) * 24 * time.Hour
+}
+
+var current atomic.Pointer[Config]
+
+// Current returns the effective configuration; callers should not keep it across requests, since
+// a reload replaces it
+func Current() *Config {
+	if c := current.Load(); c != nil {
+		return c
+	}
+	current.CompareAndSwap(nil, Defaults())
+	return current.Load()
+}
+
+// Set replaces the effective configuration
+func Set(c *Config) {
+	current.Store(c)
+}
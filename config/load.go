@@ -0,0 +1,250 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultFile is read when present and no other file is named
+const defaultFile = "config.yaml"
+
+// Loader builds the configuration from its layers; it remembers the file and flags so the
+// configuration can be rebuilt on reload
+type Loader struct {
+	path     string // "" when no file is used
+	explicit bool   // the file was named by -config or CONFIG_FILE and must exist
+	flags    *flag.FlagSet
+}
+
+// NewLoader parses command-line arguments (without the program name). The config file is named by
+// -config, then CONFIG_FILE, then config.yaml in the working directory if it exists.
+func NewLoader(args []string) (*Loader, error) {
+	l := &Loader{flags: flag.NewFlagSet("devops-autopilot", flag.ContinueOnError)}
+	l.flags.String("config", "", "path to a YAML configuration file (env CONFIG_FILE)")
+	l.flags.Int("port", 0, "port to listen on (env PORT)")
+	l.flags.Duration("shutdown-grace-period", 0, "time to drain requests and jobs on shutdown (env SHUTDOWN_GRACE_PERIOD)")
+	l.flags.String("openai-model", "", "OpenAI model (env OPENAI_MODEL)")
+	l.flags.String("copilot-model", "", "GitHub Models model (env COPILOT_MODEL)")
+	l.flags.Int("job-workers", 0, "background job workers (env JOB_WORKERS)")
+	if err := l.flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	l.path = l.flags.Lookup("config").Value.String()
+	if l.path == "" {
+		l.path = os.Getenv("CONFIG_FILE")
+	}
+	l.explicit = l.path != ""
+	if !l.explicit {
+		if _, err := os.Stat(defaultFile); err == nil {
+			l.path = defaultFile
+		}
+	}
+	return l, nil
+}
+
+// Path returns the configuration file in use, or "" when there is none
+func (l *Loader) Path() string {
+	return l.path
+}
+
+// Load builds and validates the configuration from defaults, the file, the environment and flags
+func (l *Loader) Load() (*Config, error) {
+	c := Defaults()
+	if l.path != "" {
+		if err := readFile(l.path, c); err != nil {
+			if l.explicit || !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+	}
+	envErr := applyEnv(c)
+	l.applyFlags(c)
+	c.normalize()
+
+	if err := errors.Join(envErr, c.Validate()); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return c, nil
+}
+
+// readFile decodes a YAML file over c, rejecting unknown keys so typos are not silently ignored
+func readFile(path string, c *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyFlags applies the flags that were set on the command line
+func (l *Loader) applyFlags(c *Config) {
+	l.flags.Visit(func(f *flag.Flag) {
+		getter := f.Value.(flag.Getter)
+		switch f.Name {
+		case "port":
+			c.Server.Port = getter.Get().(int)
+		case "shutdown-grace-period":
+			c.Server.ShutdownGracePeriod = Duration(getter.Get().(time.Duration))
+		case "openai-model":
+			c.Providers.OpenAI.Model = f.Value.String()
+		case "copilot-model":
+			c.Providers.Copilot.Model = f.Value.String()
+		case "job-workers":
+			c.Jobs.Workers = getter.Get().(int)
+		}
+	})
+}
+
+// applyEnv applies the environment variables that are set
+func applyEnv(c *Config) error {
+	env := &envReader{}
+
+	env.int(&c.Server.Port, "PORT")
+	env.duration(&c.Server.ShutdownGracePeriod, "SHUTDOWN_GRACE_PERIOD")
+	env.list(&c.Server.TrustedProxies, "TRUSTED_PROXIES")
+
+	env.bool(&c.Providers.OpenAI.Disabled, "OPENAI_DISABLED")
+	env.string(&c.Providers.OpenAI.APIKey, "OPENAI_API_KEY")
+	env.string(&c.Providers.OpenAI.Model, "OPENAI_MODEL")
+	env.duration(&c.Providers.OpenAI.Timeout, "OPENAI_TIMEOUT")
+	env.bool(&c.Providers.Copilot.Disabled, "COPILOT_DISABLED")
+	env.string(&c.Providers.Copilot.Model, "COPILOT_MODEL")
+	env.duration(&c.Providers.Copilot.Timeout, "COPILOT_TIMEOUT")
+
+	env.string(&c.GitHub.Token, "GITHUB_TOKEN")
+	env.string(&c.GitHub.WebhookSecret, "GITHUB_WEBHOOK_SECRET")
+	env.list(&c.GitHub.ChatOpsAllowedUsers, "GITHUB_CHATOPS_ALLOWED_USERS")
+	env.list(&c.GitHub.PullRequestRepos, "GITHUB_PULL_REQUEST_REPOS")
+	env.string(&c.GitHub.APIURL, "GITHUB_API_URL")
+
+	env.string(&c.Terraform.PluginCacheDir, "TF_PLUGIN_CACHE_DIR")
+	env.string(&c.Terraform.SchemaCacheDir, "TF_SCHEMA_CACHE_DIR")
+	env.list(&c.Terraform.SchemaProviders, "TF_SCHEMA_PROVIDERS")
+	env.string(&c.Lint.ConfigDir, "TFLINT_CONFIG_DIR")
+	env.string(&c.Lint.PluginDir, "TFLINT_PLUGIN_DIR")
+
+	env.int(&c.Jobs.Workers, "JOB_WORKERS")
+	env.int(&c.Jobs.QueueSize, "JOB_QUEUE_SIZE")
+	env.string(&c.Jobs.PendingFile, "JOB_PENDING_FILE")
+	env.bool(&c.Readiness.ProbeProviders, "READINESS_PROBE_PROVIDERS")
+
+	env.bool(&c.Auth.Disabled, "AUTH_DISABLED")
+	env.string(&c.Auth.APIKeysFile, "AUTH_API_KEYS_FILE")
+	env.string(&c.Auth.JWKSFile, "AUTH_JWKS_FILE")
+	env.string(&c.Auth.JWTIssuer, "AUTH_JWT_ISSUER")
+	env.string(&c.Auth.JWTAudience, "AUTH_JWT_AUDIENCE")
+	env.string(&c.Auth.JWTRolesClaim, "AUTH_JWT_ROLES_CLAIM")
+	env.string(&c.Auth.JWTTenantClaim, "AUTH_JWT_TENANT_CLAIM")
+
+	env.string(&c.Storage.Backend, "STORAGE_BACKEND")
+	env.string(&c.Storage.Dir, "STORAGE_DIR")
+	env.string(&c.Storage.QuarantineDir, "QUARANTINE_DIR")
+	env.string(&c.Storage.S3.Endpoint, "S3_ENDPOINT")
+	env.string(&c.Storage.S3.Bucket, "S3_BUCKET")
+	env.string(&c.Storage.S3.Prefix, "S3_PREFIX")
+	env.string(&c.Storage.S3.Region, "S3_REGION")
+	env.string(&c.Storage.S3.AccessKeyID, "S3_ACCESS_KEY_ID")
+	env.string(&c.Storage.S3.SecretAccessKey, "S3_SECRET_ACCESS_KEY")
+	env.bool(&c.Storage.S3.UseSSL, "S3_USE_SSL")
+	env.string(&c.Storage.SQLite.Path, "SQLITE_PATH")
+	env.string(&c.Storage.SQLite.QuarantinePath, "QUARANTINE_SQLITE_PATH")
+
+	env.string(&c.GitSink.Repo, "GIT_SINK_REPO")
+	env.string(&c.GitSink.BaseBranch, "GIT_SINK_BASE_BRANCH")
+	env.string(&c.GitSink.Path, "GIT_SINK_PATH")
+	env.string(&c.GitSink.AuthorName, "GIT_SINK_AUTHOR_NAME")
+	env.string(&c.GitSink.AuthorEmail, "GIT_SINK_AUTHOR_EMAIL")
+
+	env.string(&c.Tenants.File, "TENANTS_FILE")
+	env.string(&c.Tenants.UsageFile, "TENANT_USAGE_FILE")
+	env.string(&c.RateLimit.RedisURL, "RATE_LIMIT_REDIS_URL")
+
+	env.string(&c.Logging.Level, "LOG_LEVEL")
+	env.string(&c.Logging.Format, "LOG_FORMAT")
+	env.string(&c.Logging.RedactPattern, "LOG_REDACT_PATTERN")
+	env.string(&c.Tracing.Exporter, "OTEL_TRACES_EXPORTER")
+
+	env.int(&c.Policies.QuarantineRetentionDays, "QUARANTINE_RETENTION_DAYS")
+	env.string(&c.Limits.Terraform, "RATE_LIMIT_TERRAFORM")
+	env.string(&c.Limits.TerraformCopilot, "RATE_LIMIT_TERRAFORM_COPILOT")
+	env.string(&c.Limits.Validate, "RATE_LIMIT_VALIDATE")
+
+	return errors.Join(env.errs...)
+}
+
+// envReader copies set environment variables into typed fields, collecting parse errors
+type envReader struct {
+	errs []error
+}
+
+// string reads a non-empty string
+func (r *envReader) string(target *string, key string) {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		*target = value
+	}
+}
+
+// list reads a comma-separated list
+func (r *envReader) list(target *[]string, key string) {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*target = items
+	}
+}
+
+// int reads an integer
+func (r *envReader) int(target *int, key string) {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s: invalid integer %q", key, value))
+			return
+		}
+		*target = parsed
+	}
+}
+
+// bool reads a boolean
+func (r *envReader) bool(target *bool, key string) {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s: invalid boolean %q", key, value))
+			return
+		}
+		*target = parsed
+	}
+}
+
+// duration reads a duration such as "30s"
+func (r *envReader) duration(target *Duration, key string) {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s: invalid duration %q", key, value))
+			return
+		}
+		*target = Duration(parsed)
+	}
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// watchInterval is how often the config file is checked for changes
+const watchInterval = 5 * time.Second
+
+var (
+	infoMu   sync.RWMutex
+	file     string
+	loadedAt time.Time
+
+	reloadHooksMu sync.RWMutex
+	reloadHooks   []func(*Config)
+)
+
+// Init parses command-line arguments, loads and validates the configuration and makes it current
+func Init(args []string) (*Loader, error) {
+	loader, err := NewLoader(args)
+	if err != nil {
+		return nil, err
+	}
+	c, err := loader.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	Set(c)
+	infoMu.Lock()
+	file, loadedAt = loader.Path(), time.Now().UTC()
+	infoMu.Unlock()
+	return loader, nil
+}
+
+// Info returns the config file in use ("" when there is none) and when the configuration was last loaded
+func Info() (string, time.Time) {
+	infoMu.RLock()
+	defer infoMu.RUnlock()
+	return file, loadedAt
+}
+
+// Reload rebuilds the configuration and applies its providers, GitHub credentials, prompts, policies
+// and limits. Other sections need a restart; changes to them are logged and ignored. An invalid
+// configuration is rejected and the current one kept.
+func (l *Loader) Reload() error {
+	next, err := l.Load()
+	if err != nil {
+		return err
+	}
+
+	previous := Current()
+	applied := *previous
+	applied.Providers = next.Providers
+	applied.GitHub = next.GitHub
+	applied.Prompts = next.Prompts
+	applied.Policies = next.Policies
+	applied.Limits = next.Limits
+	Set(&applied)
+
+	infoMu.Lock()
+	loadedAt = time.Now().UTC()
+	infoMu.Unlock()
+
+	if sections := restartRequired(previous, next); len(sections) > 0 {
+		slog.Warn("Configuration changes need a restart to take effect", "sections", sections)
+	}
+
+	reloadHooksMu.RLock()
+	hooks := reloadHooks
+	reloadHooksMu.RUnlock()
+	for _, hook := range hooks {
+		hook(&applied)
+	}
+	return nil
+}
+
+// OnReload registers a function called with the new configuration after each successful reload
+func OnReload(hook func(*Config)) {
+	reloadHooksMu.Lock()
+	reloadHooks = append(reloadHooks, hook)
+	reloadHooksMu.Unlock()
+}
+
+// restartRequired lists the sections that differ but are only read at startup
+func restartRequired(previous, next *Config) []string {
+	sections := []string{}
+	for name, pair := range map[string][2]any{
+		"server":     {previous.Server, next.Server},
+		"terraform":  {previous.Terraform, next.Terraform},
+		"lint":       {previous.Lint, next.Lint},
+		"jobs":       {previous.Jobs, next.Jobs},
+		"readiness":  {previous.Readiness, next.Readiness},
+		"auth":       {previous.Auth, next.Auth},
+		"storage":    {previous.Storage, next.Storage},
+		"git_sink":   {previous.GitSink, next.GitSink},
+		"tenants":    {previous.Tenants, next.Tenants},
+		"rate_limit": {previous.RateLimit, next.RateLimit},
+		"logging":    {previous.Logging, next.Logging},
+		"tracing":    {previous.Tracing, next.Tracing},
+	} {
+		if !reflect.DeepEqual(pair[0], pair[1]) {
+			sections = append(sections, name)
+		}
+	}
+	sort.Strings(sections)
+	return sections
+}
+
+// Watch reloads the configuration when the config file changes or the process receives SIGHUP,
+// until ctx is done
+func (l *Loader) Watch(ctx context.Context) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	modified := l.modTime()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangups:
+			modified = l.modTime()
+			l.reload("signal")
+		case <-ticker.C:
+			if current := l.modTime(); !current.Equal(modified) {
+				modified = current
+				l.reload("file")
+			}
+		}
+	}
+}
+
+// reload reloads the configuration and logs the outcome
+func (l *Loader) reload(trigger string) {
+	if err := l.Reload(); err != nil {
+		slog.Error("Configuration reload failed, keeping the current configuration", "trigger", trigger, "error", err)
+		return
+	}
+	slog.Info("Configuration reloaded", "trigger", trigger, "file", l.path)
+}
+
+// modTime returns the config file's modification time, or the zero time when there is no file
+func (l *Loader) modTime() time.Time {
+	if l.path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"devops-autopilot/models"
+	"devops-autopilot/services"
+	"devops-autopilot/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Artifact list pagination defaults
+const (
+	defaultArtifactPageSize = 20
+	maxArtifactPageSize     = 100
+)
+
+// artifactID reads and validates the :id path parameter
+func artifactID(c *gin.Context) (string, bool) {
+	id := c.Param("id")
+	if !storage.ValidID(id) {
+		badRequest(c, "Invalid artifact ID", "")
+		return "", false
+	}
+	return id, true
+}
+
+// parseDateParam accepts RFC 3339 timestamps or plain YYYY-MM-DD dates
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// artifactFilter builds a list filter and page from query parameters
+func artifactFilter(c *gin.Context) (services.ArtifactFilter, int, int, error) {
+	filter := services.ArtifactFilter{
+		Provider: strings.TrimSpace(c.Query("provider")),
+		Resource: c.Query("resource"),
+	}
+
+	if value := c.Query("valid"); value != "" {
+		valid, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, 0, 0, fmt.Errorf("valid must be true or false")
+		}
+		filter.Valid = &valid
+	}
+
+	if value := c.Query("since"); value != "" {
+		since, err := parseDateParam(value)
+		if err != nil {
+			return filter, 0, 0, fmt.Errorf("since must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+		filter.Since = since
+	}
+
+	if value := c.Query("until"); value != "" {
+		until, err := parseDateParam(value)
+		if err != nil {
+			return filter, 0, 0, fmt.Errorf("until must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+		// A plain date includes the whole day
+		if len(value) == len("2006-01-02") {
+			until = until.AddDate(0, 0, 1)
+		}
+		filter.Until = until
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		return filter, 0, 0, fmt.Errorf("page must be a positive integer")
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(defaultArtifactPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxArtifactPageSize {
+		return filter, 0, 0, fmt.Errorf("pageSize must be between 1 and %d", maxArtifactPageSize)
+	}
+
+	filter.Offset = (page - 1) * pageSize
+	filter.Limit = pageSize
+	return filter, page, pageSize, nil
+}
+
+// ListArtifacts lists saved artifacts, newest first, with filters and pagination
+func ListArtifacts(c *gin.Context) {
+	filter, page, pageSize, err := artifactFilter(c)
+	if err != nil {
+		badRequest(c, "Invalid query parameters", err.Error())
+		return
+	}
+
+	service, ok := serviceFor(c)
+	if !ok {
+		return
+	}
+
+	artifacts, total, err := service.ListArtifacts(filter)
+	if err != nil {
+		respondError(c, err, "Failed to list artifacts")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ArtifactListResponse{
+		Artifacts: artifacts,
+		Total:     total,
+		Page:      page,
+		PageSize:  pageSize,
+	})
+}
+
+// GetArtifact returns an artifact as JSON, or the raw .tf file with ?format=raw
+func GetArtifact(c *gin.Context) {
+	id, ok := artifactID(c)
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "raw" {
+		badRequest(c, "format must be \"json\" or \"raw\"", "")
+		return
+	}
+
+	service, ok := serviceFor(c)
+	if !ok {
+		return
+	}
+
+	artifact, err := service.GetArtifact(id)
+	if err != nil {
+		respondError(c, err, "Failed to read artifact")
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, artifact)
+		return
+	}
+
+	// Raw output is a single file; modules are downloaded as a zip
+	if artifact.Kind != storage.KindFile || len(artifact.Files) != 1 {
+		badRequest(c, "Module artifacts have several files; use format=json or the download endpoint", "")
+		return
+	}
+
+	file := artifact.Files[0]
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", file.Path))
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(file.Content))
+}
+
+// DownloadArtifact returns an artifact and its metadata record as a zip archive
+func DownloadArtifact(c *gin.Context) {
+	id, ok := artifactID(c)
+	if !ok {
+		return
+	}
+
+	service, ok := serviceFor(c)
+	if !ok {
+		return
+	}
+
+	artifact, err := service.GetArtifact(id)
+	if err != nil {
+		respondError(c, err, "Failed to read artifact")
+		return
+	}
+
+	var archive bytes.Buffer
+	if err := service.WriteArtifactZip(&archive, artifact); err != nil {
+		respondError(c, err, "Failed to build archive")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".zip"))
+	c.Data(http.StatusOK, "application/zip", archive.Bytes())
+}
+
+// DeleteArtifact removes an artifact and its metadata record
+func DeleteArtifact(c *gin.Context) {
+	id, ok := artifactID(c)
+	if !ok {
+		return
+	}
+
+	service, ok := serviceFor(c)
+	if !ok {
+		return
+	}
+
+	if err := service.DeleteArtifact(id); err != nil {
+		respondError(c, err, "Failed to delete artifact")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Artifact deleted",
+		"id":      id,
+	})
+}
+
+// DiffArtifacts compares two artifacts given by the from and to query parameters
+func DiffArtifacts(c *gin.Context) {
+	from, to := c.Query("from"), c.Query("to")
+	if !storage.ValidID(from) || !storage.ValidID(to) {
+		badRequest(c, "from and to must be valid artifact IDs", "")
+		return
+	}
+
+	service, ok := serviceFor(c)
+	if !ok {
+		return
+	}
+
+	diff, err := service.DiffArtifacts(from, to)
+	if err != nil {
+		respondError(c, err, "Failed to compare artifacts")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ArtifactDiffResponse{
+		From:      from,
+		To:        to,
+		Identical: diff == "",
+		Diff:      diff,
+	})
+}
+
+// ListQuarantine lists quarantined (invalid) generations, newest first, with the same filters as ListArtifacts
+func ListQuarantine(c *gin.Context) {
+	filter, page, pageSize, err := artifactFilter(c)
+	if err != nil {
+		badRequest(c, "Invalid query parameters", err.Error())
+		return
+	}
+
+	service, ok := serviceFor(c)
+	if !ok {
+		return
+	}
+
+	artifacts, total, err := service.ListQuarantine(filter)
+	if err != nil {
+		respondError(c, err, "Failed to list quarantine")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ArtifactListResponse{
+		Artifacts: artifacts,
+		Total:     total,
+		Page:      page,
+		PageSize:  pageSize,
+	})
+}
+
+// GetQuarantined returns a quarantined generation with its files and diagnostics
+func GetQuarantined(c *gin.Context) {
+	id, ok := artifactID(c)
+	if !ok {
+		return
+	}
+
+	service, ok := serviceFor(c)
+	if !ok {
+		return
+	}
+
+	artifact, err := service.GetQuarantined(id)
+	if err != nil {
+		respondError(c, err, "Failed to read quarantined generation")
+		return
+	}
+
+	c.JSON(http.StatusOK, artifact)
+}
+
+// GetArtifactMetadata returns the provenance record of a saved artifact
+func GetArtifactMetadata(c *gin.Context) {
+	id, ok := artifactID(c)
+	if !ok {
+		return
+	}
+
+	service, ok := serviceFor(c)
+	if !ok {
+		return
+	}
+
+	metadata, err := service.GetArtifactMetadata(id)
+	if err != nil {
+		respondError(c, err, "Failed to read artifact metadata")
+		return
+	}
+
+	c.JSON(http.StatusOK, metadata)
+}
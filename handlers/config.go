@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"net/http"
+
+	"devops-autopilot/config"
+	"devops-autopilot/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetConfig returns the effective configuration with credentials redacted
+func GetConfig(c *gin.Context) {
+	file, loadedAt := config.Info()
+	c.JSON(http.StatusOK, models.ConfigResponse{
+		File:     file,
+		LoadedAt: loadedAt,
+		Config:   config.Current().Redacted(),
+	})
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"devops-autopilot/middleware"
+	"devops-autopilot/models"
+	"devops-autopilot/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondError writes the error envelope for err; fallback is the message for untyped errors
+func respondError(c *gin.Context, err error, fallback string) {
+	status, response := models.NewErrorResponse(err, fallback, middleware.GetRequestID(c))
+	c.AbortWithStatusJSON(status, response)
+}
+
+// badRequest writes an invalid_request error; details may be empty
+func badRequest(c *gin.Context, message, details string) {
+	abortWithError(c, utils.CodeInvalidRequest, message, details)
+}
+
+// abortWithError writes an error envelope for a code without an underlying error
+func abortWithError(c *gin.Context, code utils.ErrorCode, message, details string) {
+	middleware.AbortWithError(c, code, message, details)
+}
+
+// NotFound answers unknown routes with the error envelope
+func NotFound(c *gin.Context) {
+	abortWithError(c, utils.CodeNotFound, "Route not found", c.Request.Method+" "+c.Request.URL.Path)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"devops-autopilot/config"
+	"devops-autopilot/models"
+	"devops-autopilot/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Livez reports that the process is running and serving requests
+func Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, models.HealthResponse{Status: "ok"})
+}
+
+// readinessCacheTTL is how long a readiness report is reused, so unauthenticated probes cannot make
+// the service run terraform and storage checks on every request
+const readinessCacheTTL = 5 * time.Second
+
+// readinessTimeout bounds a readiness run; it does not depend on the caller staying connected,
+// since the report is shared with other callers
+const readinessTimeout = 15 * time.Second
+
+var (
+	readinessMu      sync.Mutex
+	readinessReport  *services.ReadinessReport
+	readinessChecked time.Time
+)
+
+// currentReadiness returns a recent readiness report, running the checks when the cached one is
+// stale; concurrent callers wait for the same run
+func currentReadiness(c *gin.Context) *services.ReadinessReport {
+	readinessMu.Lock()
+	defer readinessMu.Unlock()
+
+	if readinessReport == nil || time.Since(readinessChecked) > readinessCacheTTL {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), readinessTimeout)
+		defer cancel()
+		probe := config.Current().Readiness.ProbeProviders
+		readinessReport = terraformService.Readiness(ctx, services.ReadinessOptions{ProbeProviders: probe})
+		readinessChecked = time.Now()
+	}
+	return readinessReport
+}
+
+// readinessStatus maps a report to the probe's HTTP status
+func readinessStatus(report *services.ReadinessReport) int {
+	if !report.Ready {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// Readyz reports whether the service can validate and store generations, and which capabilities
+// are available; it returns 503 when the service should not receive traffic. It needs no
+// credentials, so failure details are left to GetReadiness.
+func Readyz(c *gin.Context) {
+	report := currentReadiness(c)
+	status := "ready"
+	if !report.Ready {
+		status = "not_ready"
+	}
+	c.JSON(readinessStatus(report), models.ReadinessResponse{Status: status, Capabilities: report.Capabilities})
+}
+
+// GetReadiness returns the full readiness report with each check's result, for admins
+func GetReadiness(c *gin.Context) {
+	report := currentReadiness(c)
+	c.JSON(readinessStatus(report), report)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+
+	"devops-autopilot/middleware"
+	"devops-autopilot/models"
+	"devops-autopilot/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListProviders reports whether each LLM provider is enabled for the caller, with the model used
+// for generations and the models the provider offers
+func ListProviders(c *gin.Context) {
+	tenant := middleware.GetTenant(c)
+	response := models.ProviderListResponse{Providers: make([]models.ProviderResponse, len(utils.ProviderNames))}
+
+	// Model lists come from the providers, so they are fetched concurrently
+	var wg sync.WaitGroup
+	for i, name := range utils.ProviderNames {
+		credential := ""
+		if tenant != nil {
+			credential = tenant.Credentials.For(name)
+		}
+		provider := models.ProviderResponse{ProviderStatus: utils.GetProviderStatus(name, credential)}
+		response.Providers[i] = provider
+		if !provider.Enabled {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, name, credential string) {
+			defer wg.Done()
+			list, err := utils.ListModels(c.Request.Context(), name, credential)
+			if err != nil {
+				response.Providers[i].ModelsError = err.Error()
+				return
+			}
+			response.Providers[i].Models = list
+		}(i, name, credential)
+	}
+	wg.Wait()
+
+	c.JSON(http.StatusOK, response)
+}
@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"context"
+	"log/slog"
 	"net/http"
 	"strings"
 
+	"devops-autopilot/middleware"
 	"devops-autopilot/models"
 	"devops-autopilot/services"
+	"devops-autopilot/storage"
+	"devops-autopilot/tenants"
 	"devops-autopilot/utils"
 
 	"github.com/gin-gonic/gin"
@@ -13,10 +18,140 @@ import (
 
 var terraformService = services.NewTerraformService()
 
+// serviceFor returns a service that saves to the caller's tenant namespace, or the shared service
+// when the caller has no registered tenant. It writes the error response and returns false on failure.
+func serviceFor(c *gin.Context) (*services.TerraformService, bool) {
+	service, err := serviceForTenant(middleware.GetTenant(c))
+	if err != nil {
+		respondError(c, err, "")
+		return nil, false
+	}
+	return service, true
+}
+
+// serviceForTenant returns a service that saves to a tenant's namespace, or the shared service for nil
+func serviceForTenant(tenant *tenants.Tenant) (*services.TerraformService, error) {
+	if tenant == nil {
+		return terraformService, nil
+	}
+
+	store, quarantine, err := storage.ForTenant(tenant.ID)
+	if err != nil {
+		return nil, utils.NewError(utils.CodeStorageError, "Failed to open tenant storage", err)
+	}
+	return services.NewTerraformServiceWithStorage(store, quarantine), nil
+}
+
+// lintOptions builds lint options from request fields and the caller's tenant
+func lintOptions(c *gin.Context, enabled bool, ruleset string) services.LintOptions {
+	return services.LintOptions{
+		Enabled: enabled,
+		Ruleset: ruleset,
+		Tenant:  middleware.GetTenantID(c),
+	}
+}
+
+// clientInfo identifies the caller for provenance records
+func clientInfo(c *gin.Context) services.ClientInfo {
+	client := services.ClientInfo{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Tenant:    middleware.GetTenantID(c),
+	}
+	if principal := middleware.GetPrincipal(c); principal != nil {
+		client.Principal = principal.String()
+	}
+	return client
+}
+
+// pullRequestOptions builds pull request options from a request and the caller's tenant
+func pullRequestOptions(c *gin.Context, req *models.PullRequestRequest) services.PullRequestOptions {
+	return services.PullRequestOptions{
+		Repo:       req.Repo,
+		BaseBranch: req.BaseBranch,
+		Path:       req.Path,
+		Draft:      req.Draft,
+		Tenant:     middleware.GetTenant(c),
+	}
+}
+
+// persistedGeneration records where a generation was saved, committed or proposed
+type persistedGeneration struct {
+	artifactID   string
+	quarantineID string
+	git          *models.GitResult
+	pullRequest  *models.PullRequestResult
+}
+
+// persistGeneration saves a valid generation, commits it to the git sink when configured and opens
+// a pull request when requested; an invalid generation is quarantined instead.
+// It writes the error response and returns false when saving fails. Once the artifact is saved,
+// a failed commit or pull request is reported in the response instead.
+func persistGeneration(c *gin.Context, service *services.TerraformService, result *services.GenerationResult, pullRequest *models.PullRequestRequest) (*persistedGeneration, bool) {
+	saved := &persistedGeneration{}
+	if !result.Validation.IsValid {
+		saved.quarantineID = quarantine(c.Request.Context(), service, result)
+		return saved, true
+	}
+
+	metadata, err := service.SaveGeneration(c.Request.Context(), result)
+	if err != nil {
+		respondError(c, err, "Failed to save terraform file")
+		return nil, false
+	}
+	saved.artifactID = metadata.ID
+
+	// Commit to the git sink when one is configured
+	if utils.GitSinkEnabled() {
+		commit, err := service.CommitGeneration(metadata, result)
+		saved.git = &models.GitResult{GitCommitResult: commit}
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "Failed to commit generation to git sink", "artifact_id", metadata.ID, "error", err)
+			saved.git.Error = models.NewStepError(err, "Failed to commit terraform code to git", middleware.GetRequestID(c))
+		}
+	}
+
+	// Propose the generation to a GitHub repository when requested
+	if pullRequest != nil {
+		pull, err := service.OpenPullRequest(c.Request.Context(), metadata, result, pullRequestOptions(c, pullRequest))
+		saved.pullRequest = &models.PullRequestResult{PullRequestResult: pull}
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "Failed to open pull request", "artifact_id", metadata.ID, "repo", pullRequest.Repo, "error", err)
+			saved.pullRequest.Error = models.NewStepError(err, "Failed to open pull request", middleware.GetRequestID(c))
+		}
+	}
+
+	return saved, true
+}
+
+// quarantine saves an invalid generation for later analysis and returns its ID.
+// Failures are logged only: the caller still gets the generated code and its diagnostics.
+func quarantine(ctx context.Context, service *services.TerraformService, result *services.GenerationResult) string {
+	metadata, err := service.QuarantineGeneration(ctx, result)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to quarantine invalid generation", "error", err)
+		return ""
+	}
+	return metadata.ID
+}
+
+// validOutputMode reports whether an output mode is supported; empty selects the default
+func validOutputMode(mode string) bool {
+	return mode == "" || mode == services.OutputModeFile || mode == services.OutputModeModule
+}
+
+// moduleFiles returns the module file tree in module output mode
+func moduleFiles(result *services.GenerationResult) []utils.ModuleFile {
+	if result.Module == nil {
+		return nil
+	}
+	return result.Module.Files
+}
+
 // HealthCheck handles the health check endpoint
 func HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, models.HealthResponse{
-		Status: "Service is healthy test",
+		Status: "Service is healthy",
 	})
 }
 
@@ -25,28 +160,23 @@ func ValidateTerraform(c *gin.Context) {
 	var req models.ValidationRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request format",
-			"details": err.Error(),
-		})
+		badRequest(c, "Invalid request format", err.Error())
 		return
 	}
 
 	// Validate required fields
 	if strings.TrimSpace(req.TerraformCode) == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "terraformCode field cannot be empty",
-		})
+		badRequest(c, "terraformCode field cannot be empty", "")
 		return
 	}
 
 	// Validate the provided Terraform code
-	validation, err := utils.ValidateTerraformCode(req.TerraformCode)
+	validation, format, err := terraformService.ValidateCode(c.Request.Context(), req.TerraformCode, services.ValidateOptions{
+		CheckFormat: req.CheckFormat,
+		Lint:        lintOptions(c, req.Lint, req.LintRuleset),
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to validate terraform code",
-			"details": err.Error(),
-		})
+		respondError(c, err, "Failed to validate terraform code")
 		return
 	}
 
@@ -59,6 +189,34 @@ func ValidateTerraform(c *gin.Context) {
 	c.JSON(statusCode, models.ValidationResponse{
 		Message:    "Terraform validation completed",
 		Validation: validation,
+		Format:     format,
+	})
+}
+
+// ExtractVariables handles lifting hard-coded values in existing code into variables
+func ExtractVariables(c *gin.Context) {
+	var req models.ExtractVariablesRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, "Invalid request format", err.Error())
+		return
+	}
+
+	// Validate required fields
+	if strings.TrimSpace(req.TerraformCode) == "" {
+		badRequest(c, "terraformCode field cannot be empty", "")
+		return
+	}
+
+	result, err := terraformService.ExtractVariables(req.TerraformCode)
+	if err != nil {
+		respondError(c, err, "Failed to extract variables")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ExtractVariablesResponse{
+		Message: "Variable extraction completed",
+		Result:  result,
 	})
 }
 
@@ -68,47 +226,57 @@ func GenerateTerraform(c *gin.Context) {
 
 	// Validate JSON input
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request format",
-			"details": err.Error(),
-		})
+		badRequest(c, "Invalid request format", err.Error())
 		return
 	}
 
 	// Validate required fields
 	if strings.TrimSpace(req.Resource) == "" || strings.TrimSpace(req.Specs) == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Resource and specs fields cannot be empty",
-		})
+		badRequest(c, "Resource and specs fields cannot be empty", "")
 		return
 	}
 
-	// Generate and validate terraform code
-	cleanedCode, validation, err := terraformService.GenerateAndValidate(req.Resource, req.Specs)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+	if !validOutputMode(req.OutputMode) {
+		badRequest(c, "outputMode must be \"file\" or \"module\"", "")
 		return
 	}
 
-	// Save file only if validation passes
-	if validation.IsValid {
-		_, err := terraformService.SaveTerraformFile(cleanedCode, req.Resource, "openai")
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Failed to save terraform file",
-				"details": err.Error(),
-			})
+	if req.PullRequest != nil {
+		if err := services.CheckPullRequest(pullRequestOptions(c, req.PullRequest)); err != nil {
+			respondError(c, err, "")
 			return
 		}
 	}
 
+	// Generate and validate terraform code
+	service, ok := serviceFor(c)
+	if !ok {
+		return
+	}
+
+	result, err := service.GenerateAndValidate(c.Request.Context(), req.Resource, req.Specs, services.GenerateOptions{
+		Lint:             lintOptions(c, req.Lint, req.LintRuleset),
+		ExtractVariables: req.ExtractVariables,
+		OutputMode:       req.OutputMode,
+		Client:           clientInfo(c),
+		Tenant:           middleware.GetTenant(c),
+	})
+	if err != nil {
+		respondError(c, err, "Failed to generate terraform code")
+		return
+	}
+
+	// Save file only if validation passes; invalid output is quarantined with its diagnostics
+	saved, ok := persistGeneration(c, service, result, req.PullRequest)
+	if !ok {
+		return
+	}
+
 	// Determine response status and message based on validation
 	statusCode := http.StatusOK
 	message := "Terraform code generated successfully"
 
-	if !validation.IsValid {
+	if !result.Validation.IsValid {
 		statusCode = http.StatusCreated // 201 - generated but has validation errors
 		message = "Terraform code generated with validation errors"
 	}
@@ -116,8 +284,17 @@ func GenerateTerraform(c *gin.Context) {
 	// Success response with validation results
 	c.JSON(statusCode, models.TerraformResponse{
 		Message:       message,
-		TerraformCode: cleanedCode,
-		Validation:    validation,
+		TerraformCode: result.Code,
+		Validation:    result.Validation,
+		Format:        result.Format,
+
+		AMIReplacements: result.AMIReplacements,
+		Variables:       result.Variables,
+		Files:           moduleFiles(result),
+		ArtifactID:      saved.artifactID,
+		QuarantineID:    saved.quarantineID,
+		Git:             saved.git,
+		PullRequest:     saved.pullRequest,
 	})
 }
 
@@ -127,47 +304,57 @@ func GenerateTerraformWithCopilot(c *gin.Context) {
 
 	// Validate JSON input
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request format",
-			"details": err.Error(),
-		})
+		badRequest(c, "Invalid request format", err.Error())
 		return
 	}
 
 	// Validate required fields
 	if strings.TrimSpace(req.Resource) == "" || strings.TrimSpace(req.Specs) == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Resource and specs fields cannot be empty",
-		})
+		badRequest(c, "Resource and specs fields cannot be empty", "")
 		return
 	}
 
-	// Generate and validate terraform code using GitHub Copilot
-	cleanedCode, validation, err := terraformService.GenerateAndValidateWithCopilot(req.Resource, req.Specs)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+	if !validOutputMode(req.OutputMode) {
+		badRequest(c, "outputMode must be \"file\" or \"module\"", "")
 		return
 	}
 
-	// Save file only if validation passes
-	if validation.IsValid {
-		_, err := terraformService.SaveTerraformFile(cleanedCode, req.Resource, "copilot")
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Failed to save terraform file",
-				"details": err.Error(),
-			})
+	if req.PullRequest != nil {
+		if err := services.CheckPullRequest(pullRequestOptions(c, req.PullRequest)); err != nil {
+			respondError(c, err, "")
 			return
 		}
 	}
 
+	// Generate and validate terraform code using GitHub Copilot
+	service, ok := serviceFor(c)
+	if !ok {
+		return
+	}
+
+	result, err := service.GenerateAndValidateWithCopilot(c.Request.Context(), req.Resource, req.Specs, services.GenerateOptions{
+		Lint:             lintOptions(c, req.Lint, req.LintRuleset),
+		ExtractVariables: req.ExtractVariables,
+		OutputMode:       req.OutputMode,
+		Client:           clientInfo(c),
+		Tenant:           middleware.GetTenant(c),
+	})
+	if err != nil {
+		respondError(c, err, "Failed to generate terraform code")
+		return
+	}
+
+	// Save file only if validation passes; invalid output is quarantined with its diagnostics
+	saved, ok := persistGeneration(c, service, result, req.PullRequest)
+	if !ok {
+		return
+	}
+
 	// Determine response status and message based on validation
 	statusCode := http.StatusOK
 	message := "Terraform code generated successfully using GitHub Copilot"
 
-	if !validation.IsValid {
+	if !result.Validation.IsValid {
 		statusCode = http.StatusCreated // 201 - generated but has validation errors
 		message = "Terraform code generated using GitHub Copilot with validation errors"
 	}
@@ -175,7 +362,16 @@ func GenerateTerraformWithCopilot(c *gin.Context) {
 	// Success response with validation results
 	c.JSON(statusCode, models.TerraformResponse{
 		Message:       message,
-		TerraformCode: cleanedCode,
-		Validation:    validation,
+		TerraformCode: result.Code,
+		Validation:    result.Validation,
+		Format:        result.Format,
+
+		AMIReplacements: result.AMIReplacements,
+		Variables:       result.Variables,
+		Files:           moduleFiles(result),
+		ArtifactID:      saved.artifactID,
+		QuarantineID:    saved.quarantineID,
+		Git:             saved.git,
+		PullRequest:     saved.pullRequest,
 	})
 }
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+
+	"devops-autopilot/models"
+	"devops-autopilot/tenants"
+	"devops-autopilot/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tenantResponse masks a tenant's credentials and adds its usage this month
+func tenantResponse(tenant tenants.Tenant) models.TenantResponse {
+	return models.TenantResponse{
+		Tenant: tenant.Redacted(),
+		Usage:  tenants.Default().Usage(tenant.ID),
+	}
+}
+
+// tenantFromRequest converts a request body into a tenant definition
+func tenantFromRequest(id string, req models.TenantRequest) tenants.Tenant {
+	return tenants.Tenant{
+		ID:                id,
+		Name:              req.Name,
+		Credentials:       req.Credentials,
+		PromptConventions: req.PromptConventions,
+		Repos:             req.Repos,
+		RateLimit:         req.RateLimit,
+		Quota:             req.Quota,
+	}
+}
+
+// ListTenants returns every tenant with its usage this month
+func ListTenants(c *gin.Context) {
+	list := tenants.Default().List()
+	response := models.TenantListResponse{Tenants: make([]models.TenantResponse, 0, len(list))}
+	for _, tenant := range list {
+		response.Tenants = append(response.Tenants, tenantResponse(tenant))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateTenant registers a new tenant
+func CreateTenant(c *gin.Context) {
+	var req models.TenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, "Invalid request format", err.Error())
+		return
+	}
+
+	tenant, err := tenants.Default().Create(tenantFromRequest(req.ID, req))
+	if err != nil {
+		respondError(c, err, "Failed to create tenant")
+		return
+	}
+
+	c.JSON(http.StatusCreated, tenantResponse(*tenant))
+}
+
+// GetTenant returns a tenant with its usage this month
+func GetTenant(c *gin.Context) {
+	tenant, err := tenants.Default().Get(c.Param("tenant"))
+	if err != nil {
+		respondError(c, err, "Failed to read tenant")
+		return
+	}
+
+	c.JSON(http.StatusOK, tenantResponse(*tenant))
+}
+
+// UpdateTenant replaces a tenant's settings; omitted credentials are kept
+func UpdateTenant(c *gin.Context) {
+	var req models.TenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, "Invalid request format", err.Error())
+		return
+	}
+
+	tenant, err := tenants.Default().Update(tenantFromRequest(c.Param("tenant"), req))
+	if err != nil {
+		respondError(c, err, "Failed to update tenant")
+		return
+	}
+	// The tenant's previous key may have been replaced
+	utils.ResetOpenAIClients()
+
+	c.JSON(http.StatusOK, tenantResponse(*tenant))
+}
+
+// DeleteTenant removes a tenant and its usage counters; its artifacts are kept
+func DeleteTenant(c *gin.Context) {
+	id := c.Param("tenant")
+	if err := tenants.Default().Delete(id); err != nil {
+		respondError(c, err, "Failed to delete tenant")
+		return
+	}
+	utils.ResetOpenAIClients()
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tenant deleted",
+		"id":      id,
+	})
+}
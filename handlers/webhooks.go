@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"devops-autopilot/config"
+	"devops-autopilot/jobs"
+	"devops-autopilot/logging"
+	"devops-autopilot/middleware"
+	"devops-autopilot/services"
+	"devops-autopilot/tenants"
+	"devops-autopilot/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookPayload bounds the size of accepted webhook bodies (GitHub caps payloads at 25 MB)
+const maxWebhookPayload = 25 << 20
+
+// chatOpsJobKind identifies queued ChatOps commands, which are replayed after a restart
+const chatOpsJobKind = "chatops"
+
+// chatOpsJob is the queued form of a ChatOps command. The tenant is looked up again when the job
+// runs, so its credentials are never written to the pending jobs file.
+type chatOpsJob struct {
+	Command  services.ChatOpsCommand `json:"command"`
+	TenantID string                  `json:"tenantId,omitempty"`
+}
+
+// RegisterJobs registers the handlers of background job kinds; call it before replaying jobs
+func RegisterJobs() {
+	jobs.Register(chatOpsJobKind, runChatOpsJob)
+}
+
+// runChatOpsJob runs a queued ChatOps command with its tenant's service
+func runChatOpsJob(ctx context.Context, payload json.RawMessage) error {
+	var job chatOpsJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return fmt.Errorf("invalid ChatOps job: %w", err)
+	}
+	var tenant *tenants.Tenant
+	if job.TenantID != "" {
+		var err error
+		if tenant, err = tenants.Default().Get(job.TenantID); err != nil {
+			return fmt.Errorf("tenant %q of ChatOps command: %w", job.TenantID, err)
+		}
+	}
+	service, err := serviceForTenant(tenant)
+	if err != nil {
+		return err
+	}
+
+	job.Command.Tenant = tenant
+	return service.RunChatOpsCommand(logging.WithAttrs(ctx, "request_id", job.Command.RequestID), job.Command)
+}
+
+// GitHubWebhook receives issue_comment events and queues /autopilot terraform commands
+func GitHubWebhook(c *gin.Context) {
+	secret := utils.GitHubWebhookSecret()
+	if secret == "" {
+		abortWithError(c, utils.CodeUnavailable, "GitHub webhook is not configured (set GITHUB_WEBHOOK_SECRET)", "")
+		return
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookPayload))
+	if err != nil {
+		badRequest(c, "Failed to read request body", err.Error())
+		return
+	}
+
+	// Verify the signature before looking at the payload
+	if !utils.VerifyGitHubSignature(secret, payload, c.GetHeader("X-Hub-Signature-256")) {
+		abortWithError(c, utils.CodeUnauthorized, "Invalid webhook signature", "")
+		return
+	}
+
+	switch event := c.GetHeader("X-GitHub-Event"); event {
+	case "ping":
+		c.JSON(http.StatusOK, gin.H{"message": "pong"})
+		return
+	case "issue_comment":
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Event %q ignored", event)})
+		return
+	}
+
+	var event utils.GitHubIssueCommentEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		badRequest(c, "Invalid issue_comment payload", err.Error())
+		return
+	}
+
+	// Only new comments from people are commands; bots (including our own replies) are ignored
+	if event.Action != "created" || event.Comment.User.Type == "Bot" {
+		c.JSON(http.StatusOK, gin.H{"message": "Comment ignored"})
+		return
+	}
+
+	resource, specs, ok := services.ParseChatOpsCommand(event.Comment.Body)
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"message": "No /autopilot command found"})
+		return
+	}
+
+	// Anyone who can comment on a public repository could otherwise spend the LLM budget
+	author := event.Comment.User.Login
+	if !utils.ChatOpsAllowed(author, event.Comment.AuthorAssociation) {
+		slog.WarnContext(c.Request.Context(), "ChatOps command from unauthorized commenter ignored",
+			"repo", event.Repository.FullName, "author", author, "association", event.Comment.AuthorAssociation)
+		c.JSON(http.StatusOK, gin.H{"message": "Commenter is not allowed to run commands"})
+		return
+	}
+
+	// Once tenants are defined, commands only run for repositories assigned to one, so the
+	// tenant's credentials, quota and usage tracking apply
+	var tenant *tenants.Tenant
+	if registry := tenants.Default(); !registry.Empty() {
+		tenant, err = registry.ForRepo(event.Repository.FullName)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"message": "Repository is not assigned to a tenant"})
+			return
+		}
+	}
+	// The result is posted with the tenant's GitHub token, or github.token when it has none
+	if (tenant == nil || tenant.Credentials.GitHubToken == "") && config.Current().GitHub.Token == "" {
+		slog.WarnContext(c.Request.Context(), "ChatOps command ignored: no GitHub token to post the result with",
+			"repo", event.Repository.FullName)
+		c.JSON(http.StatusOK, gin.H{"message": "No GitHub token configured to post the result"})
+		return
+	}
+	// GitHub redelivers with the same delivery ID; run each delivery once
+	delivery := c.GetHeader("X-GitHub-Delivery")
+	if delivery != "" && !utils.ClaimDelivery(delivery) {
+		c.JSON(http.StatusOK, gin.H{"message": "Delivery already processed"})
+		return
+	}
+
+	job := chatOpsJob{Command: services.ChatOpsCommand{
+		Repo:      event.Repository.FullName,
+		Number:    event.Issue.Number,
+		Author:    author,
+		Resource:  resource,
+		Specs:     specs,
+		Client:    clientInfo(c),
+		RequestID: middleware.GetRequestID(c),
+	}}
+	job.Command.Client.Principal = "github:" + author
+	if tenant != nil {
+		job.TenantID = tenant.ID
+		job.Command.Client.Tenant = tenant.ID
+	}
+
+	// Generation takes longer than GitHub waits for a webhook response, so it runs in the background
+	name := fmt.Sprintf("chatops %s#%d", job.Command.Repo, job.Command.Number)
+	jobID, err := jobs.Default().Enqueue(chatOpsJobKind, name, job)
+	if err != nil && delivery != "" {
+		utils.ReleaseDelivery(delivery)
+	}
+	if errors.Is(err, jobs.ErrQueueFull) || errors.Is(err, jobs.ErrQueueClosed) {
+		respondError(c, utils.NewRetryableError(utils.CodeUnavailable, "Cannot accept the command right now", err), "")
+		return
+	}
+	if err != nil {
+		respondError(c, err, "Failed to queue command")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Command queued",
+		"jobId":   jobID,
+	})
+}
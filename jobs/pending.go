@@ -0,0 +1,161 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Handler runs a job of a registered kind from its JSON payload
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = map[string]Handler{}
+)
+
+// Register sets the handler for jobs of a kind, so they can be submitted with Enqueue and replayed
+// after a restart
+func Register(kind string, handler Handler) {
+	handlersMu.Lock()
+	handlers[kind] = handler
+	handlersMu.Unlock()
+}
+
+// pendingJob is the saved form of a job dropped at shutdown
+type pendingJob struct {
+	Kind    string          `json:"kind"`
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// newKindJob builds a job that runs a registered handler
+func newKindJob(kind, name string, payload json.RawMessage) (Job, error) {
+	handlersMu.RLock()
+	handler, ok := handlers[kind]
+	handlersMu.RUnlock()
+	if !ok {
+		return Job{}, fmt.Errorf("unknown job kind %q", kind)
+	}
+	return Job{
+		Name:    name,
+		Kind:    kind,
+		Payload: payload,
+		Run:     func(ctx context.Context) error { return handler(ctx, payload) },
+	}, nil
+}
+
+// drop records a job that shutdown prevented from starting
+func (q *Queue) drop(job Job) {
+	if job.Kind == "" || q.pendingPath == "" {
+		slog.Warn("Dropping job: queue shut down", "job_id", job.ID, "job", job.Name)
+		return
+	}
+	q.droppedMu.Lock()
+	q.dropped = append(q.dropped, job)
+	q.droppedMu.Unlock()
+}
+
+// savePending writes dropped Enqueue jobs to the pending file for Replay
+func (q *Queue) savePending() {
+	q.droppedMu.Lock()
+	defer q.droppedMu.Unlock()
+	if len(q.dropped) == 0 {
+		return
+	}
+
+	pending := make([]pendingJob, 0, len(q.dropped))
+	for _, job := range q.dropped {
+		pending = append(pending, pendingJob{Kind: job.Kind, Name: job.Name, Payload: job.Payload})
+	}
+	if err := writePending(q.pendingPath, pending); err != nil {
+		for _, job := range q.dropped {
+			slog.Warn("Dropping job: queue shut down", "job_id", job.ID, "job", job.Name)
+		}
+		slog.Error("Failed to save pending jobs", "path", q.pendingPath, "error", err)
+		return
+	}
+	slog.Info("Saved pending jobs for the next start", "count", len(pending), "path", q.pendingPath)
+	q.dropped = nil
+}
+
+// Replay queues the jobs saved by the last shutdown. Handlers must be registered first. The
+// pending file is removed only once every job is queued; jobs the queue has no room for are
+// written back to it and saved again at shutdown, so they run after the next start.
+func (q *Queue) Replay() error {
+	if q.pendingPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(q.pendingPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read pending jobs: %w", err)
+	}
+	var pending []pendingJob
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return fmt.Errorf("failed to parse pending jobs %s: %w", q.pendingPath, err)
+	}
+
+	var left []pendingJob
+	for _, saved := range pending {
+		job, err := newKindJob(saved.Kind, saved.Name, saved.Payload)
+		if err == nil {
+			_, err = q.submit(job)
+		}
+		if errors.Is(err, ErrQueueFull) {
+			left = append(left, saved)
+			q.drop(job)
+			continue
+		}
+		if err != nil {
+			slog.Error("Failed to replay pending job", "job", saved.Name, "error", err)
+		}
+	}
+	slog.Info("Replayed pending jobs", "count", len(pending)-len(left))
+
+	if len(left) == 0 {
+		if err := os.Remove(q.pendingPath); err != nil {
+			return fmt.Errorf("failed to remove pending jobs: %w", err)
+		}
+		return nil
+	}
+	slog.Warn("Job queue is full, keeping pending jobs for the next start", "count", len(left), "path", q.pendingPath)
+	if err := writePending(q.pendingPath, left); err != nil {
+		return fmt.Errorf("failed to save pending jobs: %w", err)
+	}
+	return nil
+}
+
+// writePending replaces the pending file atomically. Payloads may hold user input, so the file is
+// only readable by the owner.
+func writePending(path string, pending []pendingJob) error {
+	data, err := json.MarshalIndent(pending, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
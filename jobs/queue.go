@@ -0,0 +1,224 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"devops-autopilot/logging"
+)
+
+// Defaults for the background job queue
+const (
+	defaultWorkers   = 2
+	defaultQueueSize = 100
+)
+
+// cancelTimeout is how long Shutdown waits for cancelled jobs to return before giving up on them
+const cancelTimeout = 5 * time.Second
+
+// ErrQueueFull is returned when no more jobs can be accepted
+var ErrQueueFull = errors.New("job queue is full")
+
+// ErrQueueClosed is returned when jobs are submitted after shutdown started
+var ErrQueueClosed = errors.New("job queue is shut down")
+
+// Job is a unit of background work
+type Job struct {
+	ID      string
+	Name    string // short description for logs
+	Run     func(ctx context.Context) error
+	Kind    string          // registered kind of a job submitted with Enqueue, "" otherwise
+	Payload json.RawMessage // input of a job submitted with Enqueue
+}
+
+// Queue runs jobs on a fixed pool of workers
+type Queue struct {
+	jobs    chan Job
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+
+	pendingPath string // where Enqueue jobs dropped at shutdown are saved; "" discards them
+	droppedMu   sync.Mutex
+	dropped     []Job
+
+	nextID  atomic.Int64
+	running atomic.Int64
+}
+
+// NewQueue starts a queue with the given number of workers and pending job capacity. Jobs
+// submitted with Enqueue that shutdown drops before they start are saved to pendingPath.
+func NewQueue(workers, size int, pendingPath string) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	if size < 1 {
+		size = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{
+		jobs:        make(chan Job, size),
+		ctx:         ctx,
+		cancel:      cancel,
+		pendingPath: pendingPath,
+	}
+
+	for i := 0; i < workers; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// Submit enqueues a job without blocking and returns its ID
+func (q *Queue) Submit(name string, run func(ctx context.Context) error) (string, error) {
+	return q.submit(Job{Name: name, Run: run})
+}
+
+// Enqueue submits a job of a kind registered with Register. Unlike Submit, the job survives a
+// restart: if shutdown drops it before it starts, it is saved and run again by Replay.
+func (q *Queue) Enqueue(kind, name string, payload interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %s job: %w", kind, err)
+	}
+	job, err := newKindJob(kind, name, data)
+	if err != nil {
+		return "", err
+	}
+	return q.submit(job)
+}
+
+// submit assigns the job an ID and queues it without blocking
+func (q *Queue) submit(job Job) (string, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return "", ErrQueueClosed
+	}
+
+	job.ID = fmt.Sprintf("job-%d", q.nextID.Add(1))
+	select {
+	case q.jobs <- job:
+		return job.ID, nil
+	default:
+		return "", ErrQueueFull
+	}
+}
+
+// Depth returns the number of jobs waiting for a worker
+func (q *Queue) Depth() int {
+	return len(q.jobs)
+}
+
+// Running returns the number of jobs currently executing
+func (q *Queue) Running() int {
+	return int(q.running.Load())
+}
+
+// Shutdown stops accepting jobs and waits for queued and running jobs to finish. When ctx expires
+// first, running jobs are cancelled and given cancelTimeout to return, and the remaining queue is
+// dropped; dropped Enqueue jobs are saved for Replay.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+	}
+
+	q.cancel()
+	// Take the jobs no worker has started yet, alongside workers dropping them
+	for job := range q.jobs {
+		q.drop(job)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(cancelTimeout):
+		slog.Warn("Cancelled jobs did not return in time", "running", q.Running())
+	}
+	q.savePending()
+	return fmt.Errorf("job queue shutdown: %w", ctx.Err())
+}
+
+// work runs jobs until the queue is closed
+func (q *Queue) work() {
+	defer q.workers.Done()
+
+	for job := range q.jobs {
+		// Jobs left in the queue after a forced shutdown are dropped
+		if q.ctx.Err() != nil {
+			q.drop(job)
+			continue
+		}
+		q.run(job)
+	}
+}
+
+// run executes one job, recovering from panics so a bad job cannot kill a worker
+func (q *Queue) run(job Job) {
+	q.running.Add(1)
+	defer q.running.Add(-1)
+
+	ctx := logging.WithAttrs(q.ctx, "job_id", job.ID, "job", job.Name)
+	defer func() {
+		if r := recover(); r != nil {
+			slog.ErrorContext(ctx, "Job panicked", "panic", fmt.Sprint(r))
+		}
+	}()
+
+	if err := job.Run(ctx); err != nil {
+		slog.ErrorContext(ctx, "Job failed", "error", err)
+	}
+}
+
+var (
+	defaultMu    sync.Mutex
+	defaultQueue *Queue
+)
+
+// Init starts the shared queue with the given number of workers and room for size pending jobs.
+// Enqueue jobs dropped at shutdown are saved to pendingPath.
+func Init(workers, size int, pendingPath string) {
+	defaultMu.Lock()
+	defaultQueue = NewQueue(workers, size, pendingPath)
+	defaultMu.Unlock()
+
+	slog.Info("Job queue initialized", "workers", workers, "slots", size)
+}
+
+// Default returns the shared queue, starting one with default settings if Init was not called
+func Default() *Queue {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultQueue == nil {
+		defaultQueue = NewQueue(defaultWorkers, defaultQueueSize, "")
+	}
+	return defaultQueue
+}
@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// handler adds context attributes and trace IDs to records and redacts secrets before passing them on
+type handler struct {
+	next     slog.Handler
+	redactor *Redactor
+}
+
+// Enabled implements slog.Handler
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, h.redactor.Redact(r.Message), r.PC)
+
+	for _, attr := range contextAttrs(ctx) {
+		out.AddAttrs(h.redactAttr(attr))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		out.AddAttrs(slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		out.AddAttrs(h.redactAttr(attr))
+		return true
+	})
+
+	return h.next.Handle(ctx, out)
+}
+
+// WithAttrs implements slog.Handler
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = h.redactAttr(attr)
+	}
+	return &handler{next: h.next.WithAttrs(redacted), redactor: h.redactor}
+}
+
+// WithGroup implements slog.Handler
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{next: h.next.WithGroup(name), redactor: h.redactor}
+}
+
+// redactAttr scrubs secrets from every value that can hold text, descending into groups
+func (h *handler) redactAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, h.redactor.Redact(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, len(group))
+		for i, member := range group {
+			redacted[i] = h.redactAttr(member)
+		}
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindAny:
+		switch any := value.Any().(type) {
+		case nil:
+		case error:
+			return slog.String(attr.Key, h.redactor.Redact(any.Error()))
+		case []byte:
+			return slog.String(attr.Key, h.redactor.Redact(string(any)))
+		case fmt.Stringer:
+			return slog.String(attr.Key, h.redactor.Redact(any.String()))
+		default:
+			return slog.Attr{Key: attr.Key, Value: h.redactAny(any)}
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+// redactAny scrubs structs, maps and slices by formatting them as the JSON handler would. Values
+// without secrets are passed on unchanged; scrubbed ones are logged as the redacted JSON.
+func (h *handler) redactAny(value any) slog.Value {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return slog.StringValue(h.redactor.Redact(fmt.Sprintf("%+v", value)))
+	}
+	text := string(data)
+	scrubbed := h.redactor.Redact(text)
+	switch {
+	case scrubbed == text:
+		return slog.AnyValue(value)
+	case json.Valid([]byte(scrubbed)):
+		return slog.AnyValue(json.RawMessage(scrubbed))
+	default:
+		return slog.StringValue(scrubbed)
+	}
+}
@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"devops-autopilot/config"
+)
+
+// defaultRedactor scrubs the output of the logger installed by Init
+var defaultRedactor *Redactor
+
+// Init installs the default logger: JSON lines (or text with logging.format) on stdout at
+// logging.level, with the configured credentials and logging.redact_pattern redacted. Output of the
+// standard log package goes through the same logger.
+func Init() error {
+	settings := config.Current()
+	level, err := parseLevel(settings.Logging.Level)
+	if err != nil {
+		return err
+	}
+
+	redactor, err := NewRedactor(settings.Logging.RedactPattern, settings.Secrets())
+	if err != nil {
+		return err
+	}
+
+	format := settings.Logging.Format
+	if format != "json" && format != "text" {
+		return fmt.Errorf("unknown log format %q (expected json or text)", format)
+	}
+
+	defaultRedactor = redactor
+	slog.SetDefault(slog.New(NewHandler(os.Stdout, format, level, redactor)))
+	return nil
+}
+
+// AddSecrets scrubs further values from the output of the logger installed by Init
+func AddSecrets(values ...string) {
+	if defaultRedactor != nil {
+		defaultRedactor.AddValues(values...)
+	}
+}
+
+// NewHandler creates a handler writing JSON or text that adds context attributes and redacts secrets
+func NewHandler(w io.Writer, format string, level slog.Leveler, redactor *Redactor) slog.Handler {
+	options := &slog.HandlerOptions{Level: level}
+	var next slog.Handler
+	if format == "text" {
+		next = slog.NewTextHandler(w, options)
+	} else {
+		next = slog.NewJSONHandler(w, options)
+	}
+	return &handler{next: next, redactor: redactor}
+}
+
+// parseLevel maps a logging.level value to a slog level
+func parseLevel(value string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", value)
+	}
+}
+
+// contextKey stores log attributes in a context
+type contextKey struct{}
+
+// WithAttrs returns a context whose log records carry the given key-value pairs, such as a request ID
+func WithAttrs(ctx context.Context, args ...any) context.Context {
+	existing, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	// A record parses key-value pairs the same way the slog functions do
+	var record slog.Record
+	record.Add(args...)
+
+	attrs := make([]slog.Attr, 0, len(existing)+record.NumAttrs())
+	attrs = append(attrs, existing...)
+	record.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, attr)
+		return true
+	})
+	return context.WithValue(ctx, contextKey{}, attrs)
+}
+
+// contextAttrs returns the attributes added by WithAttrs
+func contextAttrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	return attrs
+}
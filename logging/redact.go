@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// redacted replaces every secret found in log output
+const redacted = "[REDACTED]"
+
+// secretPatterns match well-known credential formats. A first capture group, when present, is kept.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`sk-(?:proj-)?[A-Za-z0-9_-]{16,}`),                                              // OpenAI API keys
+	regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{20,}`),                                                   // GitHub tokens
+	regexp.MustCompile(`github_pat_[A-Za-z0-9_]{20,}`),                                                 // GitHub fine-grained tokens
+	regexp.MustCompile(`(?:AKIA|ASIA)[0-9A-Z]{16}`),                                                    // AWS access key IDs
+	regexp.MustCompile(`eyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]+`),                   // JWTs
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]{8,}`),                                        // Authorization headers
+	regexp.MustCompile(`(?i)((?:api[_-]?key|token|secret|password)["']?\s*[:=]\s*["']?)[^\s"',;]{4,}`), // key=value assignments
+}
+
+// Redactor scrubs credentials from text
+type Redactor struct {
+	extra  *regexp.Regexp // operator-supplied pattern; its whole match is always replaced
+	mu     sync.RWMutex
+	values []string
+	known  map[string]bool // values already added, so repeated reloads do not grow the list
+}
+
+// NewRedactor creates a redactor for the built-in patterns, an optional extra regular expression
+// and exact secret values
+func NewRedactor(extraPattern string, values []string) (*Redactor, error) {
+	r := &Redactor{}
+	if strings.TrimSpace(extraPattern) != "" {
+		extra, err := regexp.Compile(extraPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid logging.redact_pattern: %w", err)
+		}
+		r.extra = extra
+	}
+	r.AddValues(values...)
+	return r, nil
+}
+
+// AddValues adds exact secret values to scrub, such as credentials read from a config file
+func (r *Redactor) AddValues(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.known == nil {
+		r.known = map[string]bool{}
+	}
+	for _, value := range values {
+		// Very short values would scrub ordinary words
+		if len(value) >= 8 && !r.known[value] {
+			r.known[value] = true
+			r.values = append(r.values, value)
+		}
+	}
+}
+
+// Redact replaces secrets in text with [REDACTED]
+func (r *Redactor) Redact(text string) string {
+	if r == nil || text == "" {
+		return text
+	}
+	r.mu.RLock()
+	for _, value := range r.values {
+		text = strings.ReplaceAll(text, value, redacted)
+	}
+	r.mu.RUnlock()
+	for _, pattern := range secretPatterns {
+		if pattern.NumSubexp() > 0 {
+			text = pattern.ReplaceAllString(text, "${1}"+redacted)
+		} else {
+			text = pattern.ReplaceAllString(text, redacted)
+		}
+	}
+	if r.extra != nil {
+		text = r.extra.ReplaceAllLiteralString(text, redacted)
+	}
+	return text
+}
@@ -1,42 +1,242 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
+	"devops-autopilot/config"
+	"devops-autopilot/handlers"
+	"devops-autopilot/jobs"
+	"devops-autopilot/logging"
+	"devops-autopilot/metrics"
+	"devops-autopilot/middleware"
+	"devops-autopilot/ratelimit"
 	"devops-autopilot/routes"
+	"devops-autopilot/services"
+	"devops-autopilot/storage"
+	"devops-autopilot/tenants"
+	"devops-autopilot/tracing"
 	"devops-autopilot/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
+// quarantinePurgeInterval is how often expired quarantined generations are removed
+const quarantinePurgeInterval = time.Hour
+
+// purgeQuarantines removes expired quarantined generations from the shared and every tenant namespace
+func purgeQuarantines(ctx context.Context, retention time.Duration) {
+	namespaces := map[string]*services.TerraformService{"shared": services.NewTerraformService()}
+	for _, tenant := range tenants.Default().List() {
+		store, quarantine, err := storage.ForTenant(tenant.ID)
+		if err != nil {
+			slog.Warn("Failed to open tenant storage", "tenant", tenant.ID, "error", err)
+			continue
+		}
+		namespaces["tenant "+tenant.ID] = services.NewTerraformServiceWithStorage(store, quarantine)
+	}
+
+	for name, service := range namespaces {
+		if purged, err := service.PurgeQuarantine(ctx, retention); err != nil {
+			slog.Warn("Failed to purge quarantine", "namespace", name, "error", err)
+		} else if purged > 0 {
+			slog.Info("Purged expired quarantined generations", "namespace", name, "count", purged, "retention", retention.String())
+		}
+	}
+}
+
+// forcedShutdownTimeout is how long cancelled requests get to return after the grace period
+const forcedShutdownTimeout = 5 * time.Second
+
+// shutdown stops accepting requests and jobs and waits up to grace for in-flight work. Work still
+// running after that is cancelled, which kills terraform subprocesses, and leftover temporary
+// directories are removed.
+func shutdown(server *http.Server, cancelRequests context.CancelFunc, grace time.Duration) {
+	slog.Info("Shutting down", "grace_period", grace.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Warn("Requests still running after the grace period, cancelling them", "error", err)
+			cancelRequests()
+
+			forceCtx, forceCancel := context.WithTimeout(context.Background(), forcedShutdownTimeout)
+			defer forceCancel()
+			if err := server.Shutdown(forceCtx); err != nil {
+				server.Close()
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		// Jobs still queued or running when ctx expires are cancelled
+		if err := jobs.Default().Shutdown(ctx); err != nil {
+			slog.Warn("Background jobs still running after the grace period were cancelled", "error", err)
+		}
+	}()
+	wg.Wait()
+	cancelRequests()
+
+	if err := tenants.Default().Flush(); err != nil {
+		slog.Warn("Failed to save tenant usage", "error", err)
+	}
+	if removed := utils.CleanupTempDirs(); removed > 0 {
+		slog.Info("Removed leftover temporary directories", "count", removed)
+	}
+	slog.Info("Shutdown complete")
+}
+
+// fatal logs an error that prevents startup and exits
+func fatal(message string, err error) {
+	slog.Error(message, "error", err)
+	os.Exit(1)
+}
+
 func main() {
 	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found")
+	envErr := godotenv.Load()
+
+	// Layer the config file, environment variables and flags, and reject invalid settings
+	loader, err := config.Init(os.Args[1:])
+	if err != nil {
+		fatal("Failed to load configuration", err)
 	}
+	settings := config.Current()
 
-	// Initialize OpenAI client
-	utils.InitOpenAI()
+	// Log JSON lines with the configured credentials redacted
+	if err := logging.Init(); err != nil {
+		fatal("Failed to initialize logging", err)
+	}
+	if envErr != nil {
+		slog.Info("No .env file found")
+	}
+	if file := loader.Path(); file != "" {
+		slog.Info("Configuration loaded", "file", file)
+	}
 
-	// Initialize GitHub client
-	utils.InitGitHub()
+	// Export traces when tracing.exporter is set
+	if err := tracing.Init(); err != nil {
+		fatal("Failed to initialize tracing", err)
+	}
+	defer tracing.Shutdown(context.Background())
 
-	// Create Gin router
-	r := gin.Default()
+	// Report which LLM providers are enabled; a provider without credentials is disabled, not fatal
+	utils.InitProviders()
+	config.OnReload(func(reloaded *config.Config) {
+		logging.AddSecrets(reloaded.Secrets()...)
+		utils.ResetOpenAIClients()
+		utils.InitProviders()
+	})
+
+	// Load API keys and JWT verification keys
+	if err := middleware.InitAuth(); err != nil {
+		fatal("Failed to initialize authentication", err)
+	}
+
+	// Load tenants and their usage counters
+	if err := tenants.Init(); err != nil {
+		fatal("Failed to load tenants", err)
+	}
+
+	// Select the store shared by per-client and per-tenant rate limits
+	if err := ratelimit.Init(settings.RateLimit.RedisURL); err != nil {
+		fatal("Failed to initialize rate limiting", err)
+	}
+
+	// Initialize artifact storage backend
+	if err := storage.Init(); err != nil {
+		fatal("Failed to initialize artifact storage", err)
+	}
+
+	// Start background workers for asynchronous jobs such as ChatOps commands
+	jobs.Init(settings.Jobs.Workers, settings.Jobs.QueueSize, settings.Jobs.PendingFile)
+	metrics.RegisterQueue(jobs.Default())
+
+	// Run the commands left queued by the last shutdown
+	handlers.RegisterJobs()
+	if err := jobs.Default().Replay(); err != nil {
+		slog.Warn("Failed to replay pending jobs", "error", err)
+	}
+
+	// Warm provider schema cache used for validation and prompt grounding
+	if providers := settings.Terraform.SchemaProviders; len(providers) > 0 {
+		go func() {
+			if err := utils.WarmProviderSchemas(providers); err != nil {
+				slog.Warn("Failed to warm provider schemas", "error", err)
+			}
+		}()
+	}
+
+	// Purge quarantined generations past their retention period, which is reloadable
+	purgeCtx, stopPurging := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(quarantinePurgeInterval)
+		defer ticker.Stop()
+		for {
+			if retention := config.Current().Policies.QuarantineRetention(); retention > 0 {
+				purgeQuarantines(purgeCtx, retention)
+			}
+			select {
+			case <-purgeCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	// Create Gin router; requests are logged by the access log middleware
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	// Client IPs come from X-Forwarded-For only when the request arrives through a trusted proxy
+	if err := r.SetTrustedProxies(settings.Server.TrustedProxies); err != nil {
+		fatal("Invalid trusted proxies", err)
+	}
 
 	// Setup all routes
 	routes.SetupRoutes(r)
 
-	// Get port from environment or default to 5000
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "5000"
+	// Requests derive their context from requestsCtx so a forced shutdown can cancel them
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:              ":" + strconv.Itoa(settings.Server.Port),
+		Handler:           r,
+		ReadHeaderTimeout: settings.Server.ReadHeaderTimeout.Std(),
+		BaseContext:       func(net.Listener) context.Context { return requestsCtx },
 	}
 
-	log.Printf("🚀 Server is running on port %s", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
-	}
+	go func() {
+		slog.Info("🚀 Server is running", "port", settings.Server.Port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Failed to start server", err)
+		}
+	}()
+
+	// Reload prompts, policies and limits when the config file changes or on SIGHUP
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	go loader.Watch(watchCtx)
+
+	// Wait for SIGINT or SIGTERM; a second signal terminates immediately
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-signals.Done()
+	stop()
+	stopWatching()
+	stopPurging()
+
+	shutdown(server, cancelRequests, settings.Server.ShutdownGracePeriod.Std())
 }
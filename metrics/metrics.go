@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every metric name
+const namespace = "autopilot"
+
+// llmBuckets cover provider calls from a fraction of a second up to the 30s client timeout
+var llmBuckets = []float64{0.25, 0.5, 1, 2, 4, 8, 15, 30, 60}
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	llmDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_request_duration_seconds",
+		Help:      "LLM provider call latency by provider, model and outcome.",
+		Buckets:   llmBuckets,
+	}, []string{"provider", "model", "outcome"})
+
+	llmErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_errors_total",
+		Help:      "Failed LLM provider calls by provider, model and error code.",
+	}, []string{"provider", "model", "code"})
+
+	llmTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_tokens_total",
+		Help:      "Tokens used by provider, model and type (prompt or completion).",
+	}, []string{"provider", "model", "type"})
+
+	terraformDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "terraform_command_duration_seconds",
+		Help:      "terraform init and validate durations by command and outcome.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30, 60, 120},
+	}, []string{"command", "outcome"})
+
+	validations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "generation_validations_total",
+		Help:      "Validated generations by provider and result (valid or invalid).",
+	}, []string{"provider", "result"})
+
+	policyFindings = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "policy_findings_total",
+		Help:      "Lint and schema findings in generations by provider, source, rule and severity.",
+	}, []string{"provider", "source", "rule", "severity"})
+)
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRequest records one HTTP request; route is the matched route pattern
+func ObserveRequest(method, route string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// ObserveLLMCall records one provider call. errorCode is empty when the call succeeded.
+func ObserveLLMCall(provider, model string, duration time.Duration, promptTokens, completionTokens int, errorCode string) {
+	outcome := "success"
+	if errorCode != "" {
+		outcome = "error"
+		llmErrors.WithLabelValues(provider, model, errorCode).Inc()
+	}
+	llmDuration.WithLabelValues(provider, model, outcome).Observe(duration.Seconds())
+	llmTokens.WithLabelValues(provider, model, "prompt").Add(float64(promptTokens))
+	llmTokens.WithLabelValues(provider, model, "completion").Add(float64(completionTokens))
+}
+
+// ObserveTerraform records the duration of a terraform command such as init or validate
+func ObserveTerraform(command string, duration time.Duration, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	terraformDuration.WithLabelValues(command, outcome).Observe(duration.Seconds())
+}
+
+// ObserveValidation records whether a provider's generation passed validation
+func ObserveValidation(provider string, valid bool) {
+	result := "invalid"
+	if valid {
+		result = "valid"
+	}
+	validations.WithLabelValues(provider, result).Inc()
+}
+
+// ObservePolicyFinding records one lint or schema finding in a provider's generation
+func ObservePolicyFinding(provider, source, rule, severity string) {
+	if rule == "" {
+		rule = "unspecified"
+	}
+	policyFindings.WithLabelValues(provider, source, rule, severity).Inc()
+}
+
+// QueueStats is implemented by job queues whose backlog is exported
+type QueueStats interface {
+	Depth() int
+	Running() int
+}
+
+// RegisterQueue exports a job queue's pending and running job counts
+func RegisterQueue(queue QueueStats) {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "job_queue_depth",
+			Help:      "Background jobs waiting for a worker.",
+		}, func() float64 { return float64(queue.Depth()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "job_queue_running",
+			Help:      "Background jobs currently executing.",
+		}, func() float64 { return float64(queue.Running()) }),
+	)
+}
@@ -0,0 +1,403 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"devops-autopilot/config"
+	"devops-autopilot/logging"
+	"devops-autopilot/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Role grants access to a group of endpoints; each role includes the ones below it
+type Role string
+
+// Roles, from least to most privileged
+const (
+	RoleValidate Role = "validate" // validate code and extract variables
+	RoleGenerate Role = "generate" // generate code and read artifacts
+	RoleAdmin    Role = "admin"    // delete artifacts, read quarantine and manage the service
+)
+
+// roleRank orders roles so a higher role satisfies a lower requirement
+var roleRank = map[Role]int{RoleValidate: 1, RoleGenerate: 2, RoleAdmin: 3}
+
+// Authentication methods recorded on a principal
+const (
+	AuthMethodAPIKey    = "api_key"
+	AuthMethodJWT       = "jwt"
+	AuthMethodAnonymous = "anonymous"
+)
+
+// principalKey stores the principal in the gin context
+const principalKey = "principal"
+
+// Principal is an authenticated caller
+type Principal struct {
+	Subject string `json:"subject"`
+	Method  string `json:"method"`
+	Roles   []Role `json:"roles"`
+	Tenant  string `json:"tenant,omitempty"` // tenant the credentials are bound to
+}
+
+// HasRole reports whether any of the principal's roles satisfies the required role
+func (p *Principal) HasRole(required Role) bool {
+	for _, role := range p.Roles {
+		if roleRank[role] >= roleRank[required] {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders the principal as method:subject for logs and provenance
+func (p *Principal) String() string {
+	return p.Method + ":" + p.Subject
+}
+
+// APIKey is a static API key from auth.api_keys_file; only the SHA-256 of the key is stored
+type APIKey struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"` // hex digest of the key
+	Roles  []Role `json:"roles"`
+	Tenant string `json:"tenant,omitempty"` // binds the key to a tenant
+}
+
+// authConfig holds loaded credentials; nil means authentication is disabled
+type authConfig struct {
+	keys        []APIKey
+	hashes      [][]byte
+	jwks        map[string]crypto.PublicKey // by kid
+	issuer      string
+	audience    string
+	rolesClaim  string
+	tenantClaim string
+}
+
+var (
+	authMu     sync.RWMutex
+	authLoaded *authConfig
+)
+
+// InitAuth loads API keys from auth.api_keys_file and JWT verification keys from auth.jwks_file.
+// Without either it fails, since every caller would be an anonymous admin, unless auth.disabled
+// (AUTH_DISABLED=true) explicitly turns authentication off.
+func InitAuth() error {
+	settings := config.Current().Auth
+	keysFile, jwksFile := settings.APIKeysFile, settings.JWKSFile
+	if keysFile == "" && jwksFile == "" {
+		if !settings.Disabled {
+			return fmt.Errorf("no API credentials configured: set AUTH_API_KEYS_FILE or AUTH_JWKS_FILE, or AUTH_DISABLED=true to run without authentication")
+		}
+		authMu.Lock()
+		authLoaded = nil
+		authMu.Unlock()
+		slog.Error("AUTH_DISABLED=true - API authentication is DISABLED and every caller is an anonymous admin; use this only for local development")
+		return nil
+	}
+	if settings.Disabled {
+		slog.Warn("AUTH_DISABLED is ignored because credentials are configured")
+	}
+
+	loaded := &authConfig{
+		issuer:      settings.JWTIssuer,
+		audience:    settings.JWTAudience,
+		rolesClaim:  settings.JWTRolesClaim,
+		tenantClaim: settings.JWTTenantClaim,
+	}
+
+	if keysFile != "" {
+		if err := loaded.loadAPIKeys(keysFile); err != nil {
+			return err
+		}
+	}
+	if jwksFile != "" {
+		if err := loaded.loadJWKS(jwksFile); err != nil {
+			return err
+		}
+	}
+
+	if len(loaded.keys) == 0 && len(loaded.jwks) == 0 {
+		return fmt.Errorf("no API keys or JWT verification keys found in auth.api_keys_file or auth.jwks_file")
+	}
+
+	authMu.Lock()
+	authLoaded = loaded
+	authMu.Unlock()
+	slog.Info("API authentication enabled", "api_keys", len(loaded.keys), "jwt_keys", len(loaded.jwks))
+	return nil
+}
+
+// loadAPIKeys reads a JSON list of API keys
+func (a *authConfig) loadAPIKeys(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read API keys file: %w", err)
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("failed to parse API keys file %s: %w", path, err)
+	}
+
+	for _, key := range keys {
+		hash, err := hex.DecodeString(key.SHA256)
+		if err != nil || len(hash) != sha256.Size {
+			return fmt.Errorf("API key %q: sha256 must be a hex SHA-256 digest", key.Name)
+		}
+		if err := checkRoles(key.Roles); err != nil {
+			return fmt.Errorf("API key %q: %w", key.Name, err)
+		}
+		a.keys = append(a.keys, key)
+		a.hashes = append(a.hashes, hash)
+	}
+	return nil
+}
+
+// loadJWKS reads RSA, EC and Ed25519 public keys from a JWKS document
+func (a *authConfig) loadJWKS(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("failed to parse JWKS file %s: %w", path, err)
+	}
+
+	a.jwks = map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := decodeBase64URL(jwk.N)
+			e, errE := decodeBase64URL(jwk.E)
+			if errN != nil || errE != nil {
+				return fmt.Errorf("JWK %q: invalid RSA parameters", jwk.Kid)
+			}
+			key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+			curve, ok := curves[jwk.Crv]
+			x, errX := decodeBase64URL(jwk.X)
+			y, errY := decodeBase64URL(jwk.Y)
+			if !ok || errX != nil || errY != nil {
+				return fmt.Errorf("JWK %q: invalid EC parameters", jwk.Kid)
+			}
+			key = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		case "OKP":
+			x, err := decodeBase64URL(jwk.X)
+			if jwk.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+				return fmt.Errorf("JWK %q: invalid Ed25519 parameters", jwk.Kid)
+			}
+			key = ed25519.PublicKey(x)
+		default:
+			slog.Warn("Skipping JWK with unsupported key type", "kid", jwk.Kid, "kty", jwk.Kty)
+			continue
+		}
+		a.jwks[jwk.Kid] = key
+	}
+
+	if len(a.jwks) == 0 {
+		return fmt.Errorf("JWKS file %s contains no usable signing keys", path)
+	}
+	return nil
+}
+
+// decodeBase64URL decodes unpadded base64url, as used by JWK parameters
+func decodeBase64URL(value string) ([]byte, error) {
+	if value == "" {
+		return nil, fmt.Errorf("empty value")
+	}
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+// checkRoles rejects unknown role names
+func checkRoles(roles []Role) error {
+	if len(roles) == 0 {
+		return fmt.Errorf("at least one role is required")
+	}
+	for _, role := range roles {
+		if _, ok := roleRank[role]; !ok {
+			return fmt.Errorf("unknown role %q (expected validate, generate or admin)", role)
+		}
+	}
+	return nil
+}
+
+// authenticateAPIKey matches a raw key against the configured hashes in constant time
+func (a *authConfig) authenticateAPIKey(raw string) *Principal {
+	sum := sha256.Sum256([]byte(raw))
+	var match *Principal
+	for i, hash := range a.hashes {
+		if subtle.ConstantTimeCompare(sum[:], hash) == 1 && match == nil {
+			match = &Principal{Subject: a.keys[i].Name, Method: AuthMethodAPIKey, Roles: a.keys[i].Roles, Tenant: a.keys[i].Tenant}
+		}
+	}
+	return match
+}
+
+// authenticateJWT verifies a bearer token against the JWKS and reads its subject and roles
+func (a *authConfig) authenticateJWT(raw string) (*Principal, error) {
+	if len(a.jwks) == 0 {
+		return nil, fmt.Errorf("bearer tokens are not accepted (no JWKS configured)")
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+	}
+	if a.issuer != "" {
+		options = append(options, jwt.WithIssuer(a.issuer))
+	}
+	if a.audience != "" {
+		options = append(options, jwt.WithAudience(a.audience))
+	}
+
+	token, err := jwt.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := a.jwks[kid]; ok {
+			return key, nil
+		}
+		// Tokens without a kid are accepted when the JWKS has a single key
+		if kid == "" && len(a.jwks) == 1 {
+			for _, key := range a.jwks {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return nil, fmt.Errorf("token has no subject")
+	}
+
+	var roles []Role
+	switch value := claims[a.rolesClaim].(type) {
+	case []interface{}:
+		for _, item := range value {
+			if name, ok := item.(string); ok {
+				roles = append(roles, Role(name))
+			}
+		}
+	case string:
+		// Space-delimited, as in the OAuth scope claim
+		for _, name := range strings.Fields(value) {
+			roles = append(roles, Role(name))
+		}
+	}
+
+	tenant, _ := claims[a.tenantClaim].(string)
+	return &Principal{Subject: subject, Method: AuthMethodJWT, Roles: roles, Tenant: tenant}, nil
+}
+
+// Authenticate identifies the caller from an X-API-Key header or an Authorization bearer token.
+// Requests without valid credentials are rejected with 401. When authentication is disabled every
+// caller is an anonymous admin.
+func Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authMu.RLock()
+		loaded := authLoaded
+		authMu.RUnlock()
+
+		var principal *Principal
+		switch {
+		case loaded == nil:
+			principal = &Principal{Subject: "anonymous", Method: AuthMethodAnonymous, Roles: []Role{RoleAdmin}}
+		case c.GetHeader("X-API-Key") != "":
+			principal = loaded.authenticateAPIKey(c.GetHeader("X-API-Key"))
+			if principal == nil {
+				AbortWithError(c, utils.CodeUnauthorized, "Invalid API key", "")
+				return
+			}
+		case strings.HasPrefix(c.GetHeader("Authorization"), "Bearer "):
+			var err error
+			principal, err = loaded.authenticateJWT(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+			if err != nil {
+				AbortWithError(c, utils.CodeUnauthorized, "Invalid bearer token", err.Error())
+				return
+			}
+		default:
+			c.Header("WWW-Authenticate", `Bearer realm="devops-autopilot"`)
+			AbortWithError(c, utils.CodeUnauthorized, "Authentication required", "send an X-API-Key header or an Authorization: Bearer token")
+			return
+		}
+
+		c.Request = c.Request.WithContext(logging.WithAttrs(c.Request.Context(), "principal", principal.String()))
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// RequireRole rejects callers without the role (or a higher one) with 403
+func RequireRole(role Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := GetPrincipal(c)
+		if principal == nil || !principal.HasRole(role) {
+			AbortWithError(c, utils.CodeForbidden, "Insufficient permissions", fmt.Sprintf("the %q role is required", role))
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireUnbound rejects callers whose credentials are bound to a tenant with 403, for endpoints
+// that manage or reveal the whole service
+func RequireUnbound() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := GetPrincipal(c)
+		if principal == nil || principal.Tenant != "" {
+			AbortWithError(c, utils.CodeForbidden, "Insufficient permissions", "tenant-bound credentials cannot access service administration")
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetPrincipal returns the authenticated caller, or nil outside Authenticate
+func GetPrincipal(c *gin.Context) *Principal {
+	if value, ok := c.Get(principalKey); ok {
+		if principal, ok := value.(*Principal); ok {
+			return principal
+		}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"devops-autopilot/models"
+	"devops-autopilot/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AbortWithError stops the request with an error envelope for a code without an underlying error
+func AbortWithError(c *gin.Context, code utils.ErrorCode, message, details string) {
+	c.AbortWithStatusJSON(models.ErrorStatus(code), models.ErrorResponse{Error: models.ErrorBody{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: GetRequestID(c),
+	}})
+}
+
+// abortWithTypedError stops the request with an error envelope for a typed error
+func abortWithTypedError(c *gin.Context, err *utils.Error) {
+	status, body := models.NewErrorResponse(err, err.Message, GetRequestID(c))
+	c.AbortWithStatusJSON(status, body)
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"devops-autopilot/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireProvider rejects requests with 503 while an LLM provider is disabled. A tenant's own
+// credentials enable a provider that has no service-wide credentials.
+func RequireProvider(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credential := ""
+		if tenant := GetTenant(c); tenant != nil {
+			credential = tenant.Credentials.For(name)
+		}
+		if err := utils.CheckProvider(name, credential); err != nil {
+			abortWithTypedError(c, err)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"devops-autopilot/ratelimit"
+	"devops-autopilot/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit limits how often each client may call an endpoint. Authenticated callers are keyed
+// by principal (API key or JWT subject), anonymous callers by IP. Every response carries the
+// RateLimit-* headers; rejected requests get 429 with Retry-After. If the store fails the
+// request is let through. The limit is looked up per request so it can be reloaded; ok false
+// disables it.
+func RateLimit(name string, current func() (limit ratelimit.Limit, ok bool)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, ok := current()
+		if !ok {
+			c.Next()
+			return
+		}
+		policy := fmt.Sprintf("%d;w=%d", limit.Burst, int(math.Round(float64(limit.Burst)/limit.Rate)))
+
+		result, err := ratelimit.Default().Take(c.Request.Context(), name+":"+clientKey(c), limit)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "Rate limiter unavailable, allowing request", "limit", name, "error", err)
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		header.Set("RateLimit-Policy", policy)
+
+		if !result.Allowed {
+			retryAfter := ceilSeconds(result.RetryAfter)
+			header.Set("Retry-After", strconv.Itoa(retryAfter))
+			abortWithTypedError(c, utils.NewRetryableError(utils.CodeRateLimited,
+				fmt.Sprintf("rate limit exceeded for %s", name),
+				fmt.Errorf("retry in %d seconds", retryAfter)))
+			return
+		}
+		c.Next()
+	}
+}
+
+// clientKey identifies the caller for rate limiting
+func clientKey(c *gin.Context) string {
+	if principal := GetPrincipal(c); principal != nil && principal.Method != AuthMethodAnonymous {
+		return principal.String()
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// ceilSeconds rounds a duration up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"devops-autopilot/logging"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the request ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey stores the request ID in the gin context
+const requestIDKey = "requestID"
+
+// requestIDPattern limits accepted client-supplied IDs to safe, bounded values
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID assigns every request an ID, reusing a well-formed X-Request-ID from the client,
+// and echoes it in the response
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Request = c.Request.WithContext(logging.WithAttrs(c.Request.Context(), "request_id", id))
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("request.id", id))
+		c.Next()
+	}
+}
+
+// GetRequestID returns the ID assigned to the request, or "" outside the middleware
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// newRequestID returns 16 random bytes as hex
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"fmt"
+
+	"devops-autopilot/logging"
+	"devops-autopilot/tenants"
+	"devops-autopilot/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context keys for the resolved tenant
+const (
+	tenantIDKey = "tenantID"
+	tenantKey   = "tenant"
+)
+
+// TenantHeader names a tenant for callers whose credentials are not bound to one
+const TenantHeader = "X-Tenant-ID"
+
+// ResolveTenant determines the caller's tenant after Authenticate. Credentials bound to a tenant
+// always act for it; otherwise admins (and anonymous callers when authentication is disabled) may
+// pick one with X-Tenant-ID. While no tenants are defined the header is passed through unchecked,
+// since it then only selects a lint ruleset.
+func ResolveTenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := GetPrincipal(c)
+		requested := c.GetHeader(TenantHeader)
+		registry := tenants.Default()
+
+		id := requested
+		bound := principal != nil && principal.Tenant != ""
+		if bound {
+			if requested != "" && requested != principal.Tenant {
+				AbortWithError(c, utils.CodeForbidden, "Credentials are bound to another tenant",
+					fmt.Sprintf("%s may only act for tenant %q", principal, principal.Tenant))
+				return
+			}
+			id = principal.Tenant
+		}
+
+		if id == "" || (registry.Empty() && !bound) {
+			c.Set(tenantIDKey, id)
+			c.Next()
+			return
+		}
+
+		if !bound && (principal == nil || !principal.HasRole(RoleAdmin)) {
+			AbortWithError(c, utils.CodeForbidden, "Only admins may choose a tenant",
+				"use credentials bound to the tenant instead of the "+TenantHeader+" header")
+			return
+		}
+
+		tenant, err := registry.Get(id)
+		if err != nil {
+			AbortWithError(c, utils.CodeInvalidRequest, fmt.Sprintf("Unknown tenant %q", id), "")
+			return
+		}
+
+		c.Request = c.Request.WithContext(logging.WithAttrs(c.Request.Context(), "tenant", id))
+		c.Set(tenantIDKey, id)
+		c.Set(tenantKey, tenant)
+		c.Next()
+	}
+}
+
+// GetTenantID returns the caller's tenant ID, or "" when it has none
+func GetTenantID(c *gin.Context) string {
+	return c.GetString(tenantIDKey)
+}
+
+// GetTenant returns the caller's registered tenant, or nil
+func GetTenant(c *gin.Context) *tenants.Tenant {
+	if value, ok := c.Get(tenantKey); ok {
+		if tenant, ok := value.(*tenants.Tenant); ok {
+			return tenant
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"net/http"
+
+	"devops-autopilot/utils"
+)
+
+// ErrorResponse is the envelope for every error response
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+// ErrorBody describes an error in a machine-readable way
+type ErrorBody struct {
+	Code      utils.ErrorCode `json:"code"`
+	Message   string          `json:"message"`
+	Details   string          `json:"details,omitempty"`
+	RequestID string          `json:"request_id"`
+	Retryable bool            `json:"retryable"`
+}
+
+// errorStatus maps error codes to HTTP statuses; unknown codes are 500
+var errorStatus = map[utils.ErrorCode]int{
+	utils.CodeInvalidRequest:        http.StatusBadRequest,
+	utils.CodeUnauthorized:          http.StatusUnauthorized,
+	utils.CodeForbidden:             http.StatusForbidden,
+	utils.CodeNotFound:              http.StatusNotFound,
+	utils.CodeConflict:              http.StatusConflict,
+	utils.CodeUnprocessable:         http.StatusUnprocessableEntity,
+	utils.CodeRateLimited:           http.StatusTooManyRequests,
+	utils.CodeQuotaExceeded:         http.StatusTooManyRequests,
+	utils.CodeProviderNotConfigured: http.StatusServiceUnavailable,
+	utils.CodeProviderDisabled:      http.StatusServiceUnavailable,
+	utils.CodeProviderRateLimited:   http.StatusTooManyRequests,
+	utils.CodeProviderQuotaExceeded: http.StatusTooManyRequests,
+	utils.CodeProviderAuthFailed:    http.StatusBadGateway,
+	utils.CodeProviderRejected:      http.StatusBadGateway,
+	utils.CodeProviderError:         http.StatusBadGateway,
+	utils.CodeProviderTimeout:       http.StatusGatewayTimeout,
+	utils.CodeEmptyOutput:           http.StatusBadGateway,
+	utils.CodeTerraformFailed:       http.StatusInternalServerError,
+	utils.CodeStorageError:          http.StatusInternalServerError,
+	utils.CodeGitError:              http.StatusInternalServerError,
+	utils.CodeGitHubError:           http.StatusBadGateway,
+	utils.CodeUnavailable:           http.StatusServiceUnavailable,
+	utils.CodeInternal:              http.StatusInternalServerError,
+}
+
+// ErrorStatus returns the HTTP status for an error code
+func ErrorStatus(code utils.ErrorCode) int {
+	if status, ok := errorStatus[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// NewErrorResponse builds the envelope and status for err. Typed errors keep their code and
+// retryability; anything else is reported as an internal error with fallback as the message.
+func NewErrorResponse(err error, fallback, requestID string) (int, ErrorResponse) {
+	body := ErrorBody{
+		Code:      utils.CodeInternal,
+		Message:   fallback,
+		Details:   err.Error(),
+		RequestID: requestID,
+	}
+
+	if typed, ok := utils.AsError(err); ok {
+		body.Code = typed.Code
+		body.Message = typed.Message
+		body.Retryable = typed.Retryable
+		body.Details = ""
+		if typed != err {
+			// Keep the context added while the error was wrapped
+			body.Details = err.Error()
+		} else if typed.Err != nil {
+			body.Details = typed.Err.Error()
+		}
+	}
+
+	return ErrorStatus(body.Code), ErrorResponse{Error: body}
+}
+
+// NewStepError describes a failed follow-up step, such as a git commit, inside a successful
+// response. Only the public message is kept; the cause is logged, not returned.
+func NewStepError(err error, fallback, requestID string) *ErrorBody {
+	body := &ErrorBody{Code: utils.CodeInternal, Message: fallback, RequestID: requestID}
+	if typed, ok := utils.AsError(err); ok {
+		body.Code = typed.Code
+		body.Message = typed.Message
+		body.Retryable = typed.Retryable
+	}
+	return body
+}
@@ -1,16 +1,42 @@
 package models
 
-import "devops-autopilot/utils"
+import (
+	"time"
+
+	"devops-autopilot/config"
+	"devops-autopilot/services"
+	"devops-autopilot/tenants"
+	"devops-autopilot/utils"
+)
 
 // TerraformRequest represents the request body for terraform generation
 type TerraformRequest struct {
 	Resource string `json:"resource" binding:"required"`
 	Specs    string `json:"specs" binding:"required"`
+
+	Lint        bool   `json:"lint"`        // run tflint on the generated code
+	LintRuleset string `json:"lintRuleset"` // named tflint ruleset; defaults to the tenant's ruleset
+
+	ExtractVariables bool   `json:"extractVariables"` // lift hard-coded values into variables.tf
+	OutputMode       string `json:"outputMode"`       // "file" (default) or "module"
+
+	PullRequest *PullRequestRequest `json:"pullRequest"` // open a GitHub pull request with the generated code
+}
+
+// PullRequestRequest selects the GitHub repository a generation is proposed to
+type PullRequestRequest struct {
+	Repo       string `json:"repo"`       // owner/name
+	BaseBranch string `json:"baseBranch"` // defaults to the repository's default branch
+	Path       string `json:"path"`       // directory for generated modules, default "generated"
+	Draft      bool   `json:"draft"`
 }
 
 // ValidationRequest represents the request body for terraform validation
 type ValidationRequest struct {
 	TerraformCode string `json:"terraformCode" binding:"required"`
+	CheckFormat   bool   `json:"checkFormat"` // fail validation when code is not canonically formatted
+	Lint          bool   `json:"lint"`        // run tflint on the submitted code
+	LintRuleset   string `json:"lintRuleset"` // named tflint ruleset; defaults to the tenant's ruleset
 }
 
 // TerraformResponse represents the response for terraform generation
@@ -18,6 +44,38 @@ type TerraformResponse struct {
 	Message       string                           `json:"message"`
 	TerraformCode string                           `json:"terraformCode"`
 	Validation    *utils.TerraformValidationResult `json:"validation,omitempty"`
+	Format        *utils.TerraformFormatResult     `json:"format,omitempty"`
+
+	AMIReplacements []utils.AMIReplacement          `json:"amiReplacements,omitempty"`
+	Variables       *utils.VariableExtractionResult `json:"variables,omitempty"`
+	Files           []utils.ModuleFile              `json:"files,omitempty"`        // module file tree in module output mode
+	ArtifactID      string                          `json:"artifactId,omitempty"`   // set when the generation was saved
+	QuarantineID    string                          `json:"quarantineId,omitempty"` // set when an invalid generation was quarantined
+	Git             *GitResult                      `json:"git,omitempty"`          // branch and commit SHA when the git sink is enabled
+	PullRequest     *PullRequestResult              `json:"pullRequest,omitempty"`  // set when a pull request was requested
+}
+
+// GitResult reports the git sink commit of a saved generation, or why it failed
+type GitResult struct {
+	*utils.GitCommitResult
+	Error *ErrorBody `json:"error,omitempty"` // set when the commit failed; the artifact is saved regardless
+}
+
+// PullRequestResult reports the pull request opened for a saved generation, or why it failed
+type PullRequestResult struct {
+	*utils.PullRequestResult
+	Error *ErrorBody `json:"error,omitempty"` // set when opening failed; the artifact is saved regardless
+}
+
+// ExtractVariablesRequest represents the request body for variable extraction
+type ExtractVariablesRequest struct {
+	TerraformCode string `json:"terraformCode" binding:"required"`
+}
+
+// ExtractVariablesResponse represents the response for variable extraction
+type ExtractVariablesResponse struct {
+	Message string                          `json:"message"`
+	Result  *utils.VariableExtractionResult `json:"result"`
 }
 
 // HealthResponse represents the health check response
@@ -25,8 +83,72 @@ type HealthResponse struct {
 	Status string `json:"status"`
 }
 
+// ReadinessResponse is the public readiness probe response; check details are only shown to admins
+type ReadinessResponse struct {
+	Status       string          `json:"status"` // ready or not_ready
+	Capabilities map[string]bool `json:"capabilities"`
+}
+
 // ValidationResponse represents the validation-only response
 type ValidationResponse struct {
 	Message    string                           `json:"message"`
 	Validation *utils.TerraformValidationResult `json:"validation"`
+	Format     *utils.TerraformFormatResult     `json:"format,omitempty"`
+}
+
+// ArtifactListResponse represents a page of saved artifacts
+type ArtifactListResponse struct {
+	Artifacts []services.ArtifactSummary `json:"artifacts"`
+	Total     int                        `json:"total"` // matches across all pages
+	Page      int                        `json:"page"`
+	PageSize  int                        `json:"pageSize"`
+}
+
+// ArtifactDiffResponse represents a unified diff between two artifacts
+type ArtifactDiffResponse struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Identical bool   `json:"identical"`
+	Diff      string `json:"diff"`
+}
+
+// TenantRequest represents the body for creating or updating a tenant
+type TenantRequest struct {
+	ID                string              `json:"id"` // ignored on update; the path names the tenant
+	Name              string              `json:"name" binding:"required"`
+	Credentials       tenants.Credentials `json:"credentials"` // empty fields keep current values on update
+	PromptConventions string              `json:"promptConventions"`
+	Repos             []string            `json:"repos"` // GitHub repositories whose ChatOps commands act for the tenant
+	RateLimit         tenants.RateLimit   `json:"rateLimit"`
+	Quota             tenants.Quota       `json:"quota"`
+}
+
+// TenantResponse represents a tenant with masked credentials and its usage this month
+type TenantResponse struct {
+	tenants.Tenant
+	Usage tenants.Usage `json:"usage"`
+}
+
+// TenantListResponse represents every tenant
+type TenantListResponse struct {
+	Tenants []TenantResponse `json:"tenants"`
+}
+
+// ConfigResponse represents the effective configuration with secrets redacted
+type ConfigResponse struct {
+	File     string         `json:"file,omitempty"` // YAML file the configuration was loaded from
+	LoadedAt time.Time      `json:"loadedAt"`
+	Config   *config.Config `json:"config"`
+}
+
+// ProviderResponse describes an LLM provider as available to the caller
+type ProviderResponse struct {
+	utils.ProviderStatus
+	Models      []string `json:"models,omitempty"`      // chat models the provider offers
+	ModelsError string   `json:"modelsError,omitempty"` // why the model list could not be fetched
+}
+
+// ProviderListResponse represents every LLM provider
+type ProviderListResponse struct {
+	Providers []ProviderResponse `json:"providers"`
 }
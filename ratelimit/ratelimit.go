@@ -0,0 +1,198 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket holding up to Burst tokens, refilled at Rate tokens per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute returns a limit of n requests per minute with a burst of n
+func PerMinute(n int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: n}
+}
+
+// Result describes the outcome of taking a token
+type Result struct {
+	Allowed    bool
+	Limit      int           // bucket capacity
+	Remaining  int           // whole tokens left after this request
+	RetryAfter time.Duration // until one token is available; 0 when allowed
+	Reset      time.Duration // until the bucket is full again
+}
+
+// Store keeps bucket state; implementations must be safe for concurrent use
+type Store interface {
+	// Take removes one token from the bucket for key, if one is available
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// bucket is the state of one token bucket
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Idle buckets are dropped after bucketIdleTTL, by a sweep that runs at most every sweepInterval
+const (
+	bucketIdleTTL = time.Hour
+	sweepInterval = time.Minute
+)
+
+// MemoryStore keeps buckets in process memory
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// Take implements Store
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+
+	result := take(b, limit, now)
+	s.evict(now)
+	return result, nil
+}
+
+// take refills a bucket for the time elapsed and removes one token if possible
+func take(b *bucket, limit Limit, now time.Time) Result {
+	capacity := float64(limit.Burst)
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed*limit.Rate)
+	}
+	b.updated = now
+
+	result := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else if limit.Rate > 0 {
+		result.RetryAfter = time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	} else {
+		result.RetryAfter = time.Hour
+	}
+	result.Remaining = int(b.tokens)
+	if limit.Rate > 0 {
+		result.Reset = time.Duration((capacity - b.tokens) / limit.Rate * float64(time.Second))
+	}
+	return result
+}
+
+// evict drops idle buckets so the map does not grow without bound. The map is scanned at most
+// once per sweepInterval, so the cost is spread over every request in that interval.
+func (s *MemoryStore) evict(now time.Time) {
+	if now.Sub(s.swept) < sweepInterval {
+		return
+	}
+	s.swept = now
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) > bucketIdleTTL {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// ParseLimit parses "<requests>/<s|m|h>" with an optional ":<burst>", e.g. "10/m" or "100/h:20".
+// The burst defaults to the request count. "off" and "0" disable the limit (ok is false).
+func ParseLimit(value string) (limit Limit, ok bool, err error) {
+	value = strings.TrimSpace(value)
+	if value == "off" || value == "0" {
+		return Limit{}, false, nil
+	}
+
+	spec, burstText, hasBurst := strings.Cut(value, ":")
+	countText, unit, found := strings.Cut(spec, "/")
+	if !found {
+		return Limit{}, false, fmt.Errorf("invalid rate limit %q (expected e.g. 10/m)", value)
+	}
+	count, err := strconv.Atoi(countText)
+	if err != nil || count <= 0 {
+		return Limit{}, false, fmt.Errorf("invalid request count in rate limit %q", value)
+	}
+	periods := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+	period, known := periods[unit]
+	if !known {
+		return Limit{}, false, fmt.Errorf("invalid period in rate limit %q (expected s, m or h)", value)
+	}
+
+	limit = Limit{Rate: float64(count) / period.Seconds(), Burst: count}
+	if hasBurst {
+		burst, err := strconv.Atoi(burstText)
+		if err != nil || burst <= 0 {
+			return Limit{}, false, fmt.Errorf("invalid burst in rate limit %q", value)
+		}
+		limit.Burst = burst
+	}
+	return limit, true, nil
+}
+
+var (
+	defaultMu    sync.RWMutex
+	defaultStore Store
+)
+
+// Init selects the bucket store: Redis when redisURL (rate_limit.redis_url) is set, so limits
+// are shared by every replica, otherwise process memory
+func Init(redisURL string) error {
+	var store Store = NewMemoryStore()
+	if redisURL != "" {
+		redisStore, err := NewRedisStore(redisURL, "autopilot:ratelimit:")
+		if err != nil {
+			return err
+		}
+		store = redisStore
+		slog.Info("Rate limits are shared through Redis")
+	}
+
+	SetDefault(store)
+	return nil
+}
+
+// SetDefault replaces the store returned by Default, e.g. with a custom shared implementation
+func SetDefault(store Store) {
+	defaultMu.Lock()
+	defaultStore = store
+	defaultMu.Unlock()
+}
+
+// Default returns the store selected by Init, or an in-memory store
+func Default() Store {
+	defaultMu.RLock()
+	store := defaultStore
+	defaultMu.RUnlock()
+	if store != nil {
+		return store
+	}
+
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultStore == nil {
+		defaultStore = NewMemoryStore()
+	}
+	return defaultStore
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes from a bucket stored as a hash, atomically on the Redis server.
+// KEYS[1] = bucket; ARGV = rate (tokens/s), burst, now (ms). Returns {allowed, tokens * 1000}.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(state[1]) or burst
+local updated = tonumber(state[2]) or now
+if now > updated then
+  tokens = math.min(burst, tokens + (now - updated) / 1000 * rate)
+end
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", tostring(now))
+local ttl = 3600
+if rate > 0 then ttl = math.ceil(burst / rate) + 1 end
+redis.call("EXPIRE", KEYS[1], ttl)
+return {allowed, math.floor(tokens * 1000)}
+`)
+
+// RedisStore keeps buckets in Redis so every replica shares the same limits
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore connects to Redis at a redis:// or rediss:// URL
+func NewRedisStore(url, prefix string) (*RedisStore, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	client := redis.NewClient(options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return &RedisStore{client: client, prefix: prefix}, nil
+}
+
+// Take implements Store
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	values, err := takeScript.Run(ctx, s.client, []string{s.prefix + key},
+		limit.Rate, limit.Burst, time.Now().UnixMilli()).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to update rate limit bucket: %w", err)
+	}
+
+	tokens := float64(values[1]) / 1000
+	result := Result{Allowed: values[0] == 1, Limit: limit.Burst, Remaining: int(tokens)}
+	if limit.Rate > 0 {
+		if !result.Allowed {
+			result.RetryAfter = time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+		}
+		result.Reset = time.Duration((float64(limit.Burst) - tokens) / limit.Rate * float64(time.Second))
+	} else if !result.Allowed {
+		result.RetryAfter = time.Hour
+	}
+	return result, nil
+}
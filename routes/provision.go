@@ -1,9 +1,17 @@
 package routes
 
 import (
+	"net/http"
+
+	"devops-autopilot/config"
 	"devops-autopilot/handlers"
+	"devops-autopilot/metrics"
+	"devops-autopilot/middleware"
+	"devops-autopilot/ratelimit"
+	"devops-autopilot/tracing"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // SetupProvisionRoutes sets up all provision-related routes
@@ -11,22 +19,93 @@ func SetupProvisionRoutes(router *gin.RouterGroup) {
 	// Health check endpoint
 	router.GET("/health", handlers.HealthCheck)
 
+	// Everything else requires credentials
+	secured := router.Group("", middleware.Authenticate(), middleware.ResolveTenant())
+	validate := middleware.RequireRole(middleware.RoleValidate)
+	generate := middleware.RequireRole(middleware.RoleGenerate)
+	admin := middleware.RequireRole(middleware.RoleAdmin)
+	unbound := middleware.RequireUnbound()
+
 	// Terraform generation endpoint (OpenAI)
-	router.POST("/terraform", handlers.GenerateTerraform)
+	secured.POST("/terraform", generate, middleware.RequireProvider("openai"),
+		rateLimit("terraform"), handlers.GenerateTerraform)
 
 	// Terraform generation endpoint (GitHub Copilot)
-	router.POST("/terraform-copilot", handlers.GenerateTerraformWithCopilot)
+	secured.POST("/terraform-copilot", generate, middleware.RequireProvider("copilot"),
+		rateLimit("terraform-copilot"), handlers.GenerateTerraformWithCopilot)
 
 	// Terraform validation endpoint
-	router.POST("/validate", handlers.ValidateTerraform)
+	secured.POST("/validate", validate,
+		rateLimit("validate"), handlers.ValidateTerraform)
+
+	// LLM providers, whether they are enabled and their models
+	secured.GET("/providers", generate, handlers.ListProviders)
+
+	// Variable extraction endpoint
+	secured.POST("/extract-variables", validate, handlers.ExtractVariables)
+
+	// Artifact history endpoints
+	secured.GET("/artifacts", generate, handlers.ListArtifacts)
+	secured.GET("/artifacts/diff", generate, handlers.DiffArtifacts)
+	secured.GET("/artifacts/:id", generate, handlers.GetArtifact)
+	secured.GET("/artifacts/:id/download", generate, handlers.DownloadArtifact)
+	secured.GET("/artifacts/:id/metadata", generate, handlers.GetArtifactMetadata)
+	secured.DELETE("/artifacts/:id", admin, handlers.DeleteArtifact)
+
+	// Quarantined (invalid) generations
+	secured.GET("/quarantine", admin, handlers.ListQuarantine)
+	secured.GET("/quarantine/:id", admin, handlers.GetQuarantined)
+
+	// Effective configuration with secrets redacted; service-wide, so not for tenant-bound admins
+	secured.GET("/config", admin, unbound, handlers.GetConfig)
+
+	// Readiness checks with their failure details
+	secured.GET("/readiness", admin, unbound, handlers.GetReadiness)
+
+	// Tenant administration
+	tenantAdmin := secured.Group("/admin/tenants", admin, unbound)
+	tenantAdmin.GET("", handlers.ListTenants)
+	tenantAdmin.POST("", handlers.CreateTenant)
+	tenantAdmin.GET("/:tenant", handlers.GetTenant)
+	tenantAdmin.PUT("/:tenant", handlers.UpdateTenant)
+	tenantAdmin.DELETE("/:tenant", handlers.DeleteTenant)
+}
+
+// rateLimit returns a per-client limiter using the route's current limit from the configuration
+func rateLimit(name string) gin.HandlerFunc {
+	return middleware.RateLimit(name, func() (ratelimit.Limit, bool) {
+		return config.Current().Limits.RateLimit(name)
+	})
 }
 
 // SetupRoutes sets up all application routes
 func SetupRoutes(r *gin.Engine) {
+	// Trace every request except metric scrapes and probes, joining traces propagated by the caller
+	r.Use(otelgin.Middleware(tracing.ServiceName, otelgin.WithFilter(func(req *http.Request) bool {
+		return req.URL.Path != "/metrics" && req.URL.Path != "/livez" && req.URL.Path != "/readyz"
+	})))
+
+	// Log every request, tagged with an ID that is echoed in responses and error bodies
+	r.Use(middleware.AccessLog())
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Metrics())
+	r.NoRoute(handlers.NotFound)
+
+	// Prometheus scrape endpoint
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// Liveness and readiness probes
+	r.GET("/livez", handlers.Livez)
+	r.GET("/readyz", handlers.Readyz)
+
 	// API group
 	api := r.Group("/api/provision")
 	SetupProvisionRoutes(api)
 
+	// Webhooks authenticate with their own signatures
+	webhooks := r.Group("/webhooks")
+	webhooks.POST("/github", handlers.GitHubWebhook)
+
 	// Future route groups can be added here
 	// v2 := r.Group("/api/v2")
 	// auth := r.Group("/auth")
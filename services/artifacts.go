@@ -0,0 +1,433 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-autopilot/storage"
+	"devops-autopilot/utils"
+)
+
+// ErrArtifactNotFound is returned when an artifact or its metadata does not exist
+var ErrArtifactNotFound error = utils.NewError(utils.CodeNotFound, "artifact not found", nil)
+
+// PolicyFinding is a lint or schema finding recorded against an artifact
+type PolicyFinding struct {
+	Source   string `json:"source"` // tflint or schema
+	Rule     string `json:"rule,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Filename string `json:"filename,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+// ArtifactMetadata is the provenance record stored alongside every saved artifact
+type ArtifactMetadata struct {
+	ID       string   `json:"id"`
+	Location string   `json:"location"`
+	Kind     string   `json:"kind"` // file or module
+	Files    []string `json:"files"`
+
+	Provenance
+	Validation     *utils.TerraformValidationResult `json:"validation,omitempty"`
+	PolicyFindings []PolicyFinding                  `json:"policyFindings"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// newArtifactMetadata builds the metadata record for a freshly saved generation
+func newArtifactMetadata(artifact *storage.SavedArtifact, result *GenerationResult) *ArtifactMetadata {
+	metadata := &ArtifactMetadata{
+		ID:             artifact.ID,
+		Location:       artifact.Location,
+		Kind:           OutputModeFile,
+		Provenance:     result.Provenance,
+		Validation:     result.Validation,
+		PolicyFindings: policyFindings(result.Validation),
+		CreatedAt:      time.Now().UTC(),
+	}
+
+	if result.Module != nil {
+		metadata.Kind = OutputModeModule
+		for name := range result.Files() {
+			metadata.Files = append(metadata.Files, name)
+		}
+		sort.Strings(metadata.Files)
+	} else {
+		metadata.Files = []string{artifact.ID + ".tf"}
+	}
+
+	return metadata
+}
+
+// policyFindings collects tflint issues and provider schema findings from a validation result
+func policyFindings(validation *utils.TerraformValidationResult) []PolicyFinding {
+	findings := []PolicyFinding{}
+	if validation == nil {
+		return findings
+	}
+
+	if validation.Lint != nil {
+		for _, issue := range validation.Lint.Issues {
+			findings = append(findings, PolicyFinding{
+				Source:   "tflint",
+				Rule:     issue.Rule,
+				Severity: issue.Severity,
+				Message:  issue.Message,
+				Filename: issue.Filename,
+				Line:     issue.Line,
+			})
+		}
+	}
+
+	for _, finding := range validation.SchemaFindings {
+		findings = append(findings, PolicyFinding{
+			Source:   "schema",
+			Severity: finding.Severity,
+			Message:  finding.Message,
+			Line:     finding.Line,
+		})
+	}
+
+	return findings
+}
+
+// putMetadata stores the metadata record of an artifact
+func putMetadata(store storage.Storage, metadata *ArtifactMetadata) error {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode artifact metadata: %w", err)
+	}
+
+	if err := store.PutMetadata(context.Background(), metadata.ID, data); err != nil {
+		return utils.NewError(utils.CodeStorageError, "failed to write artifact metadata", err)
+	}
+
+	return nil
+}
+
+// GetArtifactMetadata returns the provenance record of a saved artifact
+func (s *TerraformService) GetArtifactMetadata(id string) (*ArtifactMetadata, error) {
+	return getMetadata(s.artifactStore(), id)
+}
+
+// getMetadata reads and decodes the metadata record of an artifact
+func getMetadata(store storage.Storage, id string) (*ArtifactMetadata, error) {
+	data, err := store.GetMetadata(context.Background(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrArtifactNotFound
+	}
+	if err != nil {
+		return nil, utils.NewError(utils.CodeStorageError, "failed to read artifact metadata", err)
+	}
+
+	var metadata ArtifactMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode artifact metadata: %w", err)
+	}
+
+	return &metadata, nil
+}
+
+// ArtifactFilter selects and pages artifacts in ListArtifacts
+type ArtifactFilter struct {
+	Provider string    // exact provider, e.g. openai or copilot
+	Resource string    // case-insensitive substring of the resource text
+	Valid    *bool     // validation outcome; nil matches both
+	Since    time.Time // created at or after; zero means no lower bound
+	Until    time.Time // created before; zero means no upper bound
+	Offset   int
+	Limit    int
+}
+
+// ArtifactSummary is a listed artifact with the fields used for filtering
+type ArtifactSummary struct {
+	storage.ArtifactInfo
+	Provider string   `json:"provider"`
+	Resource string   `json:"resource"`
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors,omitempty"` // validation errors of invalid generations
+}
+
+// ArtifactDetail is a single artifact with its files and metadata record
+type ArtifactDetail struct {
+	ArtifactSummary
+	Files    []utils.ModuleFile `json:"files"`
+	Metadata *ArtifactMetadata  `json:"metadata,omitempty"` // nil for artifacts saved before metadata was recorded
+}
+
+// ListArtifacts returns the artifacts matching a filter, newest first, and the total number of matches
+func (s *TerraformService) ListArtifacts(filter ArtifactFilter) ([]ArtifactSummary, int, error) {
+	return listArtifacts(s.artifactStore(), filter)
+}
+
+// ListQuarantine returns the quarantined generations matching a filter, newest first
+func (s *TerraformService) ListQuarantine(filter ArtifactFilter) ([]ArtifactSummary, int, error) {
+	return listArtifacts(s.quarantineStore(), filter)
+}
+
+// metadataReadConcurrency bounds parallel metadata reads when a filter needs every record
+const metadataReadConcurrency = 8
+
+// listArtifacts filters and pages the artifacts of a backend. Metadata is only read for the
+// requested page unless the filter selects on provider, resource or validity.
+func listArtifacts(store storage.Storage, filter ArtifactFilter) ([]ArtifactSummary, int, error) {
+	infos, err := store.List(context.Background())
+	if err != nil {
+		return nil, 0, utils.NewError(utils.CodeStorageError, "failed to list artifacts", err)
+	}
+
+	inRange := infos[:0]
+	for _, info := range infos {
+		if !filter.Since.IsZero() && info.CreatedAt.Before(filter.Since) {
+			continue
+		}
+		if !filter.Until.IsZero() && !info.CreatedAt.Before(filter.Until) {
+			continue
+		}
+		inRange = append(inRange, info)
+	}
+	sort.SliceStable(inRange, func(i, j int) bool {
+		return inRange[i].CreatedAt.After(inRange[j].CreatedAt)
+	})
+
+	resource := strings.ToLower(strings.TrimSpace(filter.Resource))
+	if filter.Provider == "" && resource == "" && filter.Valid == nil {
+		total := len(inRange)
+		page := paginate(inRange, filter.Offset, filter.Limit)
+		return summarizeAll(store, page), total, nil
+	}
+
+	matches := []ArtifactSummary{}
+	for _, summary := range summarizeAll(store, inRange) {
+		if filter.Provider != "" && summary.Provider != filter.Provider {
+			continue
+		}
+		if resource != "" && !strings.Contains(strings.ToLower(summary.Resource), resource) {
+			continue
+		}
+		if filter.Valid != nil && summary.Valid != *filter.Valid {
+			continue
+		}
+		matches = append(matches, summary)
+	}
+	return paginate(matches, filter.Offset, filter.Limit), len(matches), nil
+}
+
+// summarizeAll reads the metadata of each artifact, a few at a time, and summarizes it
+func summarizeAll(store storage.Storage, infos []storage.ArtifactInfo) []ArtifactSummary {
+	summaries := make([]ArtifactSummary, len(infos))
+	slots := make(chan struct{}, metadataReadConcurrency)
+	var wg sync.WaitGroup
+	for i, info := range infos {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, info storage.ArtifactInfo) {
+			defer func() { <-slots; wg.Done() }()
+			metadata, _ := getMetadata(store, info.ID)
+			summaries[i] = summarize(info, metadata)
+		}(i, info)
+	}
+	wg.Wait()
+	return summaries
+}
+
+// paginate returns the items in [offset, offset+limit); a limit of 0 means no limit
+func paginate[T any](items []T, offset, limit int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// GetArtifact returns an artifact with its files and metadata record
+func (s *TerraformService) GetArtifact(id string) (*ArtifactDetail, error) {
+	return getArtifact(s.artifactStore(), id)
+}
+
+// GetQuarantined returns a quarantined generation with its files and diagnostics
+func (s *TerraformService) GetQuarantined(id string) (*ArtifactDetail, error) {
+	return getArtifact(s.quarantineStore(), id)
+}
+
+// getArtifact reads an artifact and its metadata record from a backend
+func getArtifact(store storage.Storage, id string) (*ArtifactDetail, error) {
+	artifact, err := store.Get(context.Background(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrArtifactNotFound
+	}
+	if err != nil {
+		return nil, utils.NewError(utils.CodeStorageError, "failed to read artifact", err)
+	}
+
+	metadata, _ := getMetadata(store, id)
+	detail := &ArtifactDetail{ArtifactSummary: summarize(artifact.ArtifactInfo, metadata), Metadata: metadata}
+
+	names := make([]string, 0, len(artifact.Files))
+	for name := range artifact.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		detail.Files = append(detail.Files, utils.ModuleFile{Path: name, Content: string(artifact.Files[name])})
+	}
+
+	return detail, nil
+}
+
+// DeleteArtifact removes an artifact and its metadata record
+func (s *TerraformService) DeleteArtifact(id string) error {
+	err := s.artifactStore().Delete(context.Background(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrArtifactNotFound
+	}
+	if err != nil {
+		return utils.NewError(utils.CodeStorageError, "failed to delete artifact", err)
+	}
+	return nil
+}
+
+// PurgeQuarantine deletes quarantined generations older than the retention period
+func (s *TerraformService) PurgeQuarantine(ctx context.Context, retention time.Duration) (int, error) {
+	store := s.quarantineStore()
+	infos, err := store.List(ctx)
+	if err != nil {
+		return 0, utils.NewError(utils.CodeStorageError, "failed to list quarantine", err)
+	}
+
+	cutoff := time.Now().Add(-retention)
+	purged := 0
+	for _, info := range infos {
+		if !info.CreatedAt.Before(cutoff) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+		if err := store.Delete(ctx, info.ID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return purged, fmt.Errorf("failed to purge %s: %w", info.ID, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// DiffArtifacts returns a unified diff between two artifacts, file by file.
+// A single-file artifact is compared as main.tf so it can be diffed against a module.
+func (s *TerraformService) DiffArtifacts(fromID, toID string) (string, error) {
+	from, err := s.GetArtifact(fromID)
+	if err != nil {
+		return "", err
+	}
+	to, err := s.GetArtifact(toID)
+	if err != nil {
+		return "", err
+	}
+
+	fromFiles, toFiles := comparableFiles(from), comparableFiles(to)
+	names := map[string]bool{}
+	for name := range fromFiles {
+		names[name] = true
+	}
+	for name := range toFiles {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var diff strings.Builder
+	for _, name := range sorted {
+		diff.WriteString(utils.UnifiedDiff(fromID+"/"+name, toID+"/"+name, fromFiles[name], toFiles[name]))
+	}
+	return diff.String(), nil
+}
+
+// WriteArtifactZip writes an artifact's files to w as a zip archive rooted at the artifact ID
+func (s *TerraformService) WriteArtifactZip(w io.Writer, artifact *ArtifactDetail) error {
+	archive := zip.NewWriter(w)
+	for _, file := range artifact.Files {
+		name := file.Path
+		if artifact.Kind == storage.KindModule {
+			name = artifact.ID + "/" + file.Path
+		}
+		entry, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: artifact.CreatedAt})
+		if err != nil {
+			return fmt.Errorf("failed to add %s to archive: %w", name, err)
+		}
+		if _, err := io.WriteString(entry, file.Content); err != nil {
+			return fmt.Errorf("failed to add %s to archive: %w", name, err)
+		}
+	}
+	if artifact.Metadata != nil {
+		data, err := json.MarshalIndent(artifact.Metadata, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode artifact metadata: %w", err)
+		}
+		entry, err := archive.Create(artifact.ID + ".meta.json")
+		if err != nil {
+			return fmt.Errorf("failed to add metadata to archive: %w", err)
+		}
+		if _, err := entry.Write(data); err != nil {
+			return fmt.Errorf("failed to add metadata to archive: %w", err)
+		}
+	}
+	return archive.Close()
+}
+
+// comparableFiles returns an artifact's files keyed by name, mapping a single-file artifact to main.tf
+func comparableFiles(artifact *ArtifactDetail) map[string]string {
+	files := make(map[string]string, len(artifact.Files))
+	if artifact.Kind == storage.KindFile && len(artifact.Files) == 1 {
+		files["main.tf"] = artifact.Files[0].Content
+		return files
+	}
+	for _, file := range artifact.Files {
+		files[file.Path] = file.Content
+	}
+	return files
+}
+
+// knownProviders are the generation providers used as artifact name prefixes
+var knownProviders = map[string]bool{"openai": true, "copilot": true}
+
+// summarize derives provider, resource text and validity from an artifact's metadata, or from its
+// name for artifacts saved before metadata was recorded (those were only saved when valid)
+func summarize(info storage.ArtifactInfo, metadata *ArtifactMetadata) ArtifactSummary {
+	summary := ArtifactSummary{ArtifactInfo: info, Valid: true}
+
+	name := info.ID[:strings.LastIndex(info.ID, "_")] // drop the index
+	if provider, resource, found := strings.Cut(name, "_"); found && knownProviders[provider] {
+		summary.Provider, name = provider, resource
+	}
+	summary.Resource = strings.ReplaceAll(name, "_", " ")
+
+	if metadata != nil {
+		summary.Provider = metadata.Provider
+		summary.Resource = metadata.Resource
+		if metadata.Validation != nil {
+			summary.Valid = metadata.Validation.IsValid
+			if !summary.Valid {
+				summary.Errors = metadata.Validation.Errors
+			}
+		}
+		if !metadata.CreatedAt.IsZero() {
+			summary.CreatedAt = metadata.CreatedAt
+		}
+	}
+	return summary
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"devops-autopilot/tenants"
+	"devops-autopilot/utils"
+)
+
+// chatOpsCommandPattern matches "/autopilot terraform <resource> :: <specs>" on its own line
+var chatOpsCommandPattern = regexp.MustCompile(`(?m)^[ \t]*/autopilot[ \t]+terraform[ \t]+(.+?)[ \t]*::[ \t]*(.+?)[ \t]*$`)
+
+// maxCommentCodeLength keeps result comments under GitHub's 65536 character limit
+const maxCommentCodeLength = 50000
+
+// ChatOpsCommand is a generation request typed as a comment on an issue or pull request
+type ChatOpsCommand struct {
+	Repo      string          `json:"repo"`   // owner/name
+	Number    int             `json:"number"` // issue or pull request number
+	Author    string          `json:"author"` // GitHub login of the commenter
+	Resource  string          `json:"resource"`
+	Specs     string          `json:"specs"`
+	Client    ClientInfo      `json:"client"`
+	Tenant    *tenants.Tenant `json:"-"`         // tenant the repository is assigned to, if any; never persisted
+	RequestID string          `json:"requestId"` // webhook request, quoted in failure comments so the logs can be found
+}
+
+// githubToken returns the tenant's own GitHub token, or "" to post with github.token
+func (cmd ChatOpsCommand) githubToken() string {
+	if cmd.Tenant != nil {
+		return cmd.Tenant.Credentials.GitHubToken
+	}
+	return ""
+}
+
+// ParseChatOpsCommand extracts resource and specs from a comment containing a /autopilot terraform command
+func ParseChatOpsCommand(body string) (string, string, bool) {
+	match := chatOpsCommandPattern.FindStringSubmatch(strings.ReplaceAll(body, "\r\n", "\n"))
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
+
+// RunChatOpsCommand runs the generate-and-validate pipeline for a command and posts the result as a comment
+func (s *TerraformService) RunChatOpsCommand(ctx context.Context, cmd ChatOpsCommand) error {
+	result, err := s.GenerateAndValidate(ctx, cmd.Resource, cmd.Specs, GenerateOptions{Client: cmd.Client, Tenant: cmd.Tenant})
+	if err != nil {
+		// Comments can be public: only the typed error's message is shown, details stay in the logs
+		message := "internal error"
+		if typed, ok := utils.AsError(err); ok {
+			message = typed.Message
+		}
+		comment := fmt.Sprintf("@%s ❌ Terraform generation failed for `%s`: %s\n\nRequest ID: `%s`", cmd.Author, cmd.Resource, message, cmd.RequestID)
+		if postErr := utils.CreateIssueComment(ctx, cmd.githubToken(), cmd.Repo, cmd.Number, comment); postErr != nil {
+			return fmt.Errorf("generation failed (%v) and the result could not be posted: %w", err, postErr)
+		}
+		return err
+	}
+
+	// Keep the result like the REST endpoints do: valid code is saved, invalid code is quarantined
+	savedAs := ""
+	if result.Validation.IsValid {
+		metadata, err := s.SaveGeneration(ctx, result)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to save ChatOps generation", "error", err)
+		} else {
+			savedAs = "artifact `" + metadata.ID + "`"
+			if utils.GitSinkEnabled() {
+				if commit, err := s.CommitGeneration(metadata, result); err != nil {
+					slog.WarnContext(ctx, "Failed to commit ChatOps generation", "error", err)
+				} else {
+					savedAs += " (branch `" + commit.Branch + "`)"
+				}
+			}
+		}
+	} else {
+		metadata, err := s.QuarantineGeneration(ctx, result)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to quarantine ChatOps generation", "error", err)
+		} else {
+			savedAs = "quarantine entry `" + metadata.ID + "`"
+		}
+	}
+
+	if err := utils.CreateIssueComment(ctx, cmd.githubToken(), cmd.Repo, cmd.Number, chatOpsResultComment(cmd, result, savedAs)); err != nil {
+		return fmt.Errorf("failed to post ChatOps result: %w", err)
+	}
+	return nil
+}
+
+// truncateCode cuts code to at most limit bytes at the last line break, or at a character
+// boundary when the first line is already too long
+func truncateCode(code string, limit int) string {
+	if len(code) <= limit {
+		return code
+	}
+	if cut := strings.LastIndexByte(code[:limit], '\n'); cut > 0 {
+		return code[:cut]
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(code[cut]) {
+		cut--
+	}
+	return code[:cut]
+}
+
+// codeFence returns a backtick fence one longer than the longest backtick run in code (at least
+// three), so code containing ``` cannot close the block early
+func codeFence(code string) string {
+	longest, run := 2, 0
+	for _, r := range code {
+		if r != '`' {
+			run = 0
+			continue
+		}
+		run++
+		if run > longest {
+			longest = run
+		}
+	}
+	return strings.Repeat("`", longest+1)
+}
+
+// chatOpsResultComment renders generated code, validation status and diagnostics as a comment
+func chatOpsResultComment(cmd ChatOpsCommand, result *GenerationResult, savedAs string) string {
+	var sb strings.Builder
+
+	status := "✅ Validation passed"
+	if !result.Validation.IsValid {
+		status = "❌ Validation failed"
+	}
+	sb.WriteString(fmt.Sprintf("@%s Terraform for **%s** (%s)\n\n%s", cmd.Author, markdownCell(cmd.Resource), markdownCell(cmd.Specs), status))
+	if savedAs != "" {
+		sb.WriteString(" · saved as " + savedAs)
+	}
+	sb.WriteString("\n\n")
+
+	code := result.CombinedCode()
+	if len(code) > maxCommentCodeLength {
+		code = truncateCode(code, maxCommentCodeLength) + "\n# ... truncated"
+	}
+	fence := codeFence(code)
+	sb.WriteString(fence + "hcl\n" + strings.TrimRight(code, "\n") + "\n" + fence + "\n")
+
+	validation := result.Validation
+	findings := policyFindings(validation)
+	if len(validation.Errors) > 0 || len(validation.Warnings) > 0 || len(findings) > 0 {
+		sb.WriteString("\n<details><summary>Diagnostics</summary>\n")
+		writeMarkdownList(&sb, "Errors", validation.Errors)
+		writeMarkdownList(&sb, "Warnings", validation.Warnings)
+		if len(findings) > 0 {
+			messages := make([]string, 0, len(findings))
+			for _, finding := range findings {
+				message := fmt.Sprintf("[%s/%s] %s", finding.Source, finding.Severity, finding.Message)
+				if finding.Line > 0 {
+					message += fmt.Sprintf(" (line %d)", finding.Line)
+				}
+				messages = append(messages, message)
+			}
+			writeMarkdownList(&sb, "Policy findings", messages)
+		}
+		sb.WriteString("\n</details>\n")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"devops-autopilot/config"
+	"devops-autopilot/tenants"
+	"devops-autopilot/utils"
+)
+
+// CommitGeneration commits a saved generation to the git sink on a branch named after its artifact
+func (s *TerraformService) CommitGeneration(metadata *ArtifactMetadata, result *GenerationResult) (*utils.GitCommitResult, error) {
+	commit, err := utils.CommitToGitSink(artifactPath(metadata), result.Files(), provenanceCommitMessage(metadata))
+	if err != nil {
+		return nil, utils.NewError(utils.CodeGitError, "failed to commit to git sink", err)
+	}
+	return commit, nil
+}
+
+// artifactPath names a generation's branch and directory: <tenant>/<id> for a tenant's artifact,
+// since artifact IDs are only unique within a namespace, or <id> for the shared namespace.
+// Tenant IDs never contain "_" and artifact IDs always do, so the two cannot clash.
+func artifactPath(metadata *ArtifactMetadata) string {
+	if metadata.Client.Tenant != "" {
+		return metadata.Client.Tenant + "/" + metadata.ID
+	}
+	return metadata.ID
+}
+
+// provenanceCommitMessage describes a generation and its provenance as a commit message with trailers
+func provenanceCommitMessage(metadata *ArtifactMetadata) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("Add %s (%s)\n\n", commitSubject(metadata.Resource), metadata.Provider))
+
+	if specs := strings.TrimSpace(metadata.Specs); specs != "" {
+		sb.WriteString(specs + "\n\n")
+	}
+
+	valid := "unknown"
+	if metadata.Validation != nil {
+		valid = fmt.Sprintf("%t", metadata.Validation.IsValid)
+	}
+
+	trailers := [][2]string{
+		{"Artifact-Id", metadata.ID},
+		{"Provider", metadata.Provider},
+		{"Model", metadata.Model},
+		{"Prompt-Template-Version", metadata.PromptTemplateVersion},
+		{"Tokens", fmt.Sprintf("%d prompt, %d completion, %d total",
+			metadata.Usage.PromptTokens, metadata.Usage.CompletionTokens, metadata.Usage.TotalTokens)},
+		{"Validation", valid},
+		{"Policy-Findings", fmt.Sprintf("%d", len(metadata.PolicyFindings))},
+		{"Requested-By", clientDescription(metadata.Client)},
+		{"Generated-At", metadata.CreatedAt.UTC().Format(time.RFC3339)},
+	}
+	for _, trailer := range trailers {
+		if trailer[1] != "" {
+			sb.WriteString(fmt.Sprintf("%s: %s\n", trailer[0], trailer[1]))
+		}
+	}
+
+	return sb.String()
+}
+
+// clientDescription renders client info as "principal ip (user agent) tenant=..."
+func clientDescription(client ClientInfo) string {
+	parts := []string{}
+	if client.Principal != "" {
+		parts = append(parts, client.Principal)
+	}
+	if client.IP != "" {
+		parts = append(parts, client.IP)
+	}
+	if client.UserAgent != "" {
+		parts = append(parts, "("+client.UserAgent+")")
+	}
+	if client.Tenant != "" {
+		parts = append(parts, "tenant="+client.Tenant)
+	}
+	return strings.Join(parts, " ")
+}
+
+// defaultPullRequestPath is the repository directory generated modules are added under
+const defaultPullRequestPath = "generated"
+
+// PullRequestOptions selects the repository a generation is proposed to
+type PullRequestOptions struct {
+	Repo       string // owner/name
+	BaseBranch string // defaults to the repository's default branch
+	Path       string // directory for generated modules, default "generated"
+	Draft      bool
+
+	// Tenant is the caller's tenant, or nil for callers without one. It limits the repositories
+	// that may be targeted and supplies its own GitHub token when it has one.
+	Tenant *tenants.Tenant
+}
+
+// CheckPullRequest rejects a pull request to a repository the caller may not target or to a
+// directory outside the repository's regular tree. Tenants may only target their own repos;
+// callers without a tenant may only target github.pull_request_repos.
+func CheckPullRequest(opts PullRequestOptions) error {
+	if !utils.ValidGitHubRepo(opts.Repo) {
+		return utils.NewError(utils.CodeInvalidRequest, "pullRequest.repo must be an owner/name repository", nil)
+	}
+	if _, err := pullRequestDir(opts.Path); err != nil {
+		return err
+	}
+
+	if opts.Tenant != nil {
+		if !containsRepo(opts.Tenant.Repos, opts.Repo) {
+			return utils.NewError(utils.CodeForbidden, fmt.Sprintf("repository %q is not one of tenant %q's repos", opts.Repo, opts.Tenant.ID), nil)
+		}
+		return nil
+	}
+	if !containsRepo(config.Current().GitHub.PullRequestRepos, opts.Repo) {
+		return utils.NewError(utils.CodeForbidden, fmt.Sprintf("repository %q is not allowed for pull requests (see github.pull_request_repos)", opts.Repo), nil)
+	}
+	if owner, err := tenants.Default().ForRepo(opts.Repo); err == nil {
+		return utils.NewError(utils.CodeForbidden, fmt.Sprintf("repository %q belongs to tenant %q", opts.Repo, owner.ID), nil)
+	}
+	return nil
+}
+
+// containsRepo reports whether repos lists repo, ignoring case as GitHub does
+func containsRepo(repos []string, repo string) bool {
+	for _, allowed := range repos {
+		if strings.EqualFold(allowed, repo) {
+			return true
+		}
+	}
+	return false
+}
+
+// pullRequestDir cleans the directory generated modules are added under, rejecting segments that
+// are ".." or hidden, such as .github
+func pullRequestDir(dir string) (string, error) {
+	dir = strings.Trim(dir, "/")
+	if dir == "" {
+		return defaultPullRequestPath, nil
+	}
+	for _, segment := range strings.Split(dir, "/") {
+		if segment == "" || strings.HasPrefix(segment, ".") {
+			return "", utils.NewError(utils.CodeInvalidRequest, fmt.Sprintf("pullRequest.path %q must not contain empty, \"..\" or hidden segments", dir), nil)
+		}
+	}
+	return dir, nil
+}
+
+// OpenPullRequest pushes a saved generation to a GitHub repository and opens a pull request
+// whose body carries the validation and policy report
+func (s *TerraformService) OpenPullRequest(ctx context.Context, metadata *ArtifactMetadata, result *GenerationResult, opts PullRequestOptions) (*utils.PullRequestResult, error) {
+	if err := CheckPullRequest(opts); err != nil {
+		return nil, err
+	}
+	dir, _ := pullRequestDir(opts.Path)
+
+	files := map[string]string{}
+	for name, content := range result.Files() {
+		files[path.Join(dir, artifactPath(metadata), name)] = content
+	}
+
+	token := ""
+	if opts.Tenant != nil {
+		token = opts.Tenant.Credentials.GitHubToken
+	}
+
+	pull, err := utils.OpenPullRequest(ctx, utils.PullRequestOptions{
+		Repo:          opts.Repo,
+		BaseBranch:    opts.BaseBranch,
+		Branch:        "autopilot/" + artifactPath(metadata),
+		Files:         files,
+		CommitMessage: provenanceCommitMessage(metadata),
+		Title:         fmt.Sprintf("Add %s (%s)", commitSubject(metadata.Resource), metadata.Provider),
+		Body:          pullRequestBody(metadata),
+		Draft:         opts.Draft,
+		Token:         token,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pull request: %w", err)
+	}
+	return pull, nil
+}
+
+// pullRequestBody renders the provenance, validation and policy report as markdown
+func pullRequestBody(metadata *ArtifactMetadata) string {
+	var sb strings.Builder
+
+	sb.WriteString("## Generated Terraform\n\n| | |\n|---|---|\n")
+	rows := [][2]string{
+		{"Resource", metadata.Resource},
+		{"Specs", metadata.Specs},
+		{"Provider", metadata.Provider},
+		{"Model", metadata.Model},
+		{"Prompt template", metadata.PromptTemplateVersion},
+		{"Tokens", fmt.Sprintf("%d", metadata.Usage.TotalTokens)},
+		{"Artifact", "`" + metadata.ID + "`"},
+	}
+	for _, row := range rows {
+		if row[1] != "" {
+			sb.WriteString(fmt.Sprintf("| %s | %s |\n", row[0], markdownCell(row[1])))
+		}
+	}
+
+	sb.WriteString("\n## Validation\n\n")
+	validation := metadata.Validation
+	switch {
+	case validation == nil:
+		sb.WriteString("Not validated.\n")
+	case validation.IsValid:
+		sb.WriteString("✅ `terraform validate` passed.\n")
+	default:
+		sb.WriteString("❌ `terraform validate` failed.\n")
+	}
+	if validation != nil {
+		writeMarkdownList(&sb, "Errors", validation.Errors)
+		writeMarkdownList(&sb, "Warnings", validation.Warnings)
+	}
+
+	sb.WriteString("\n## Policy report\n\n")
+	if validation != nil && validation.Lint == nil {
+		sb.WriteString("tflint was not run for this generation.\n\n")
+	}
+	if len(metadata.PolicyFindings) == 0 {
+		sb.WriteString("No lint or schema findings.\n")
+	} else {
+		sb.WriteString("| Source | Severity | Rule | Line | Message |\n|--------|----------|------|------|---------|\n")
+		for _, finding := range metadata.PolicyFindings {
+			line := ""
+			if finding.Line > 0 {
+				line = fmt.Sprintf("%d", finding.Line)
+			}
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s |\n",
+				finding.Source, finding.Severity, markdownCell(finding.Rule), line, markdownCell(finding.Message)))
+		}
+	}
+
+	sb.WriteString("\n---\nOpened by DevOps Autopilot. Review the plan before merging.\n")
+	return sb.String()
+}
+
+// writeMarkdownList writes a titled bullet list, or nothing when items is empty
+func writeMarkdownList(sb *strings.Builder, title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	sb.WriteString(fmt.Sprintf("\n**%s**\n\n", title))
+	for _, item := range items {
+		sb.WriteString("- " + strings.Join(strings.Fields(item), " ") + "\n")
+	}
+}
+
+// markdownCell makes text safe for a single markdown table cell
+func markdownCell(text string) string {
+	return strings.ReplaceAll(strings.Join(strings.Fields(text), " "), "|", "\\|")
+}
+
+// commitSubject shortens resource text for commit subjects and PR titles
+func commitSubject(resource string) string {
+	subject := strings.Join(strings.Fields(resource), " ")
+	if len(subject) > 60 {
+		// Cut on a rune boundary so a multi-byte character is never split
+		cut := 57
+		for cut > 0 && !utf8.RuneStart(subject[cut]) {
+			cut--
+		}
+		subject = subject[:cut] + "..."
+	}
+	return subject
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"devops-autopilot/storage"
+	"devops-autopilot/utils"
+)
+
+// Check statuses reported by readiness checks
+const (
+	CheckOK       = "ok"
+	CheckFailed   = "failed"
+	CheckDisabled = "disabled" // not configured; only affects the capabilities that need it
+)
+
+// providerProbeTTL is how long a provider reachability result is reused
+const providerProbeTTL = time.Minute
+
+// providerProbeTimeout bounds one provider reachability call
+const providerProbeTimeout = 10 * time.Second
+
+// CheckResult is the outcome of one readiness check
+type CheckResult struct {
+	Status  string `json:"status"`
+	Detail  string `json:"detail,omitempty"`
+	Version string `json:"version,omitempty"`
+	Backend string `json:"backend,omitempty"`
+}
+
+// ReadinessReport describes which dependencies work and which capabilities are available
+type ReadinessReport struct {
+	Ready        bool                   `json:"ready"`
+	Checks       map[string]CheckResult `json:"checks"`
+	Capabilities map[string]bool        `json:"capabilities"`
+}
+
+// ReadinessOptions controls the optional readiness checks
+type ReadinessOptions struct {
+	ProbeProviders bool // call each configured provider instead of only checking credentials are present
+}
+
+// providerProbe is a cached provider reachability result
+type providerProbe struct {
+	err     error
+	checked time.Time
+}
+
+var (
+	providerProbesMu sync.Mutex
+	providerProbes   = map[string]providerProbe{}
+)
+
+// Readiness checks the terraform CLI, the plugin cache and temporary directories, the storage
+// backends and the LLM providers. The service is ready when it can validate and store artifacts.
+// Providers only affect the generate capabilities: tenants may bring their own credentials, so
+// missing service-wide credentials do not make the service unusable.
+func (s *TerraformService) Readiness(ctx context.Context, opts ReadinessOptions) *ReadinessReport {
+	checks := map[string]func() CheckResult{
+		"terraform": func() CheckResult {
+			version, err := utils.TerraformVersion(ctx)
+			if err != nil {
+				return CheckResult{Status: CheckFailed, Detail: err.Error()}
+			}
+			return CheckResult{Status: CheckOK, Version: version}
+		},
+		"tflint": func() CheckResult {
+			if !utils.TFLintAvailable() {
+				return CheckResult{Status: CheckDisabled, Detail: "tflint is not installed; lint results report it as an error"}
+			}
+			return CheckResult{Status: CheckOK}
+		},
+		"pluginCache": func() CheckResult {
+			dir := utils.PluginCacheDir()
+			if dir == "" {
+				return CheckResult{Status: CheckDisabled, Detail: "TF_PLUGIN_CACHE_DIR is not set"}
+			}
+			return writableCheck(dir)
+		},
+		"tempDir": func() CheckResult {
+			return writableCheck(os.TempDir())
+		},
+		"storage": func() CheckResult {
+			return storageCheck(ctx, s.artifactStore())
+		},
+		"quarantine": func() CheckResult {
+			return storageCheck(ctx, s.quarantineStore())
+		},
+		"openai": func() CheckResult {
+			return providerCheck(utils.GetProviderStatus("openai", ""), opts.ProbeProviders, utils.PingOpenAI)
+		},
+		"copilot": func() CheckResult {
+			return providerCheck(utils.GetProviderStatus("copilot", ""), opts.ProbeProviders, utils.PingGitHubModels)
+		},
+	}
+
+	// Checks run concurrently so slow backends do not add up past the probe timeout
+	report := &ReadinessReport{Checks: map[string]CheckResult{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func() CheckResult) {
+			defer wg.Done()
+			result := check()
+			mu.Lock()
+			report.Checks[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	ok := func(name string) bool { return report.Checks[name].Status == CheckOK }
+	validate := ok("terraform") && ok("tempDir") && report.Checks["pluginCache"].Status != CheckFailed
+	report.Capabilities = map[string]bool{
+		"generate:openai":  ok("openai") && validate,
+		"generate:copilot": ok("copilot") && validate,
+		"validate":         validate,
+		"lint":             validate && ok("tflint"),
+		"artifacts":        ok("storage"),
+		"quarantine":       ok("quarantine"),
+		"gitSink":          utils.GitSinkEnabled(),
+	}
+	report.Ready = validate && ok("storage")
+	return report
+}
+
+// writableCheck reports whether files can be created in dir
+func writableCheck(dir string) CheckResult {
+	if err := utils.CheckWritable(dir); err != nil {
+		return CheckResult{Status: CheckFailed, Detail: err.Error()}
+	}
+	return CheckResult{Status: CheckOK}
+}
+
+// storageCheck pings a storage backend
+func storageCheck(ctx context.Context, store storage.Storage) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := store.Ping(ctx); err != nil {
+		return CheckResult{Status: CheckFailed, Backend: store.Name(), Detail: err.Error()}
+	}
+	return CheckResult{Status: CheckOK, Backend: store.Name()}
+}
+
+// providerCheck reports whether a provider is enabled and, when probing, whether it answers.
+// Probe results are cached so frequent readiness checks do not spend provider rate limits.
+func providerCheck(status utils.ProviderStatus, probe bool, ping func(context.Context) error) CheckResult {
+	if !status.Enabled {
+		return CheckResult{Status: CheckDisabled, Detail: status.Reason}
+	}
+	name := status.Name
+	if !probe {
+		return CheckResult{Status: CheckOK, Detail: "credentials present"}
+	}
+
+	providerProbesMu.Lock()
+	cached, found := providerProbes[name]
+	providerProbesMu.Unlock()
+	if !found || time.Since(cached.checked) > providerProbeTTL {
+		// The result is cached, so the probe must not fail because the caller went away
+		probeCtx, cancel := context.WithTimeout(context.Background(), providerProbeTimeout)
+		cached = providerProbe{err: ping(probeCtx), checked: time.Now()}
+		cancel()
+		providerProbesMu.Lock()
+		providerProbes[name] = cached
+		providerProbesMu.Unlock()
+	}
+
+	if cached.err != nil {
+		return CheckResult{Status: CheckFailed, Detail: cached.err.Error()}
+	}
+	return CheckResult{Status: CheckOK, Detail: "reachable"}
+}
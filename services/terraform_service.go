@@ -1,99 +1,481 @@
 package services
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
+	"devops-autopilot/config"
+	"devops-autopilot/metrics"
+	"devops-autopilot/storage"
+	"devops-autopilot/tenants"
+	"devops-autopilot/tracing"
 	"devops-autopilot/utils"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // TerraformService handles terraform-related business logic
-type TerraformService struct{}
+type TerraformService struct {
+	store      storage.Storage // nil uses the backend configured by storage.Init
+	quarantine storage.Storage // nil uses the quarantine namespace configured by storage.Init
+}
 
 // NewTerraformService creates a new terraform service
 func NewTerraformService() *TerraformService {
 	return &TerraformService{}
 }
 
+// NewTerraformServiceWithStorage creates a terraform service that saves to specific backends
+func NewTerraformServiceWithStorage(store, quarantine storage.Storage) *TerraformService {
+	return &TerraformService{store: store, quarantine: quarantine}
+}
+
+// artifactStore returns the storage backend used for saving artifacts
+func (s *TerraformService) artifactStore() storage.Storage {
+	if s.store != nil {
+		return s.store
+	}
+	return storage.Current()
+}
+
+// quarantineStore returns the storage namespace used for invalid generations
+func (s *TerraformService) quarantineStore() storage.Storage {
+	if s.quarantine != nil {
+		return s.quarantine
+	}
+	return storage.Quarantine()
+}
+
+// GenerationResult holds the output of a generate-and-validate run
+type GenerationResult struct {
+	Code       string
+	Validation *utils.TerraformValidationResult
+	Format     *utils.TerraformFormatResult
+
+	AMIReplacements []utils.AMIReplacement
+	Variables       *utils.VariableExtractionResult
+	Module          *utils.ModuleLayout
+
+	Provenance Provenance
+}
+
+// ClientInfo identifies the caller that requested a generation
+type ClientInfo struct {
+	IP        string `json:"ip"`
+	UserAgent string `json:"userAgent"`
+	Tenant    string `json:"tenant,omitempty"`
+	Principal string `json:"principal,omitempty"` // authenticated caller as method:subject
+}
+
+// Provenance records how a generation was produced
+type Provenance struct {
+	Resource              string           `json:"resource"`
+	Specs                 string           `json:"specs"`
+	Provider              string           `json:"provider"` // openai or copilot
+	Model                 string           `json:"model"`
+	PromptTemplateVersion string           `json:"promptTemplateVersion"`
+	Usage                 utils.TokenUsage `json:"usage"`
+	Client                ClientInfo       `json:"client"`
+	StartedAt             time.Time        `json:"startedAt"`
+	CompletedAt           time.Time        `json:"completedAt"`
+}
+
+// Files returns the generated module as file name to content
+func (r *GenerationResult) Files() map[string]string {
+	if r.Module != nil {
+		return r.Module.FileMap()
+	}
+	files := map[string]string{"main.tf": r.Code}
+	if r.Variables != nil && r.Variables.VariablesTF != "" {
+		files["variables.tf"] = r.Variables.VariablesTF
+	}
+	return files
+}
+
+// CombinedCode returns all generated terraform as a single file
+func (r *GenerationResult) CombinedCode() string {
+	if r.Variables == nil || r.Variables.VariablesTF == "" {
+		return r.Code
+	}
+	return strings.TrimRight(r.Variables.VariablesTF, "\n") + "\n\n" + r.Code
+}
+
+// LintOptions selects the tflint stage and its ruleset
+type LintOptions struct {
+	Enabled bool
+	Ruleset string // explicit ruleset requested by the caller
+	Tenant  string // tenant whose ruleset is used when none is requested
+}
+
+// GenerateOptions controls the optional stages of a generation run
+type GenerateOptions struct {
+	Lint             LintOptions
+	ExtractVariables bool   // lift hard-coded environment values into variables
+	OutputMode       string // OutputModeFile (default) or OutputModeModule
+	Client           ClientInfo
+	Tenant           *tenants.Tenant // credentials, conventions and limits of the caller's tenant, if any
+}
+
+// Output modes for generated code
+const (
+	OutputModeFile   = "file"   // a single flat .tf file
+	OutputModeModule = "module" // a standard module directory
+)
+
+// ValidateOptions controls how submitted terraform code is validated
+type ValidateOptions struct {
+	CheckFormat bool // fail validation when the code is not canonically formatted
+	Lint        LintOptions
+}
+
 // GenerateAndValidate generates terraform code and validates it
-func (s *TerraformService) GenerateAndValidate(resource, specs string) (string, *utils.TerraformValidationResult, error) {
+func (s *TerraformService) GenerateAndValidate(ctx context.Context, resource, specs string, opts GenerateOptions) (result *GenerationResult, err error) {
+	startedAt := time.Now().UTC()
+	ctx, span := startGenerationSpan(ctx, "openai")
+	defer func() { endGenerationSpan(span, result, err) }()
+
+	generation := generationOptions(ctx, resource, specs, opts.Tenant, "openai")
+
+	// Enforce the tenant's rate limit and quota, reserving the most the call can use, before spending tokens
+	model, estimate := usageEstimate("openai", resource, specs, generation)
+	reservation, err := tenants.Default().CheckGeneration(opts.Tenant, model, estimate)
+	if err != nil {
+		return nil, err
+	}
+
 	// Generate terraform code using OpenAI
-	tfCode, err := utils.GenerateTerraformCode(resource, specs)
+	out, err := utils.GenerateTerraformCode(ctx, resource, specs, generation)
+	if err != nil {
+		tenants.Default().Release(reservation)
+		return nil, fmt.Errorf("failed to generate terraform code: %w", err)
+	}
+	tenants.Default().Settle(reservation, out.Model, out.Usage)
+
+	result, err = s.processGeneratedCode(ctx, out.Content, resource, specs, opts)
+	if result != nil {
+		result.Provenance = newProvenance(resource, specs, "openai", out, opts.Client, startedAt)
+		observeValidation("openai", result)
+	}
+	return result, err
+}
+
+// GenerateAndValidateWithCopilot generates terraform code using GitHub Copilot and validates it
+func (s *TerraformService) GenerateAndValidateWithCopilot(ctx context.Context, resource, specs string, opts GenerateOptions) (result *GenerationResult, err error) {
+	startedAt := time.Now().UTC()
+	ctx, span := startGenerationSpan(ctx, "copilot")
+	defer func() { endGenerationSpan(span, result, err) }()
+
+	generation := generationOptions(ctx, resource, specs, opts.Tenant, "copilot")
+
+	// Enforce the tenant's rate limit and quota, reserving the most the call can use, before spending tokens
+	model, estimate := usageEstimate("copilot", resource, specs, generation)
+	reservation, err := tenants.Default().CheckGeneration(opts.Tenant, model, estimate)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to generate terraform code: %w", err)
+		return nil, err
+	}
+
+	// Generate terraform code using GitHub Copilot
+	out, err := utils.GenerateTerraformCodeWithCopilot(ctx, resource, specs, generation)
+	if err != nil {
+		tenants.Default().Release(reservation)
+		return nil, fmt.Errorf("failed to generate terraform code with GitHub Copilot: %w", err)
+	}
+	tenants.Default().Settle(reservation, out.Model, out.Usage)
+
+	result, err = s.processGeneratedCode(ctx, out.Content, resource, specs, opts)
+	if result != nil {
+		result.Provenance = newProvenance(resource, specs, "copilot", out, opts.Client, startedAt)
+		observeValidation("copilot", result)
+	}
+	return result, err
+}
+
+// generationOptions grounds a prompt in provider schemas and applies the tenant's conventions and credentials
+func generationOptions(ctx context.Context, resource, specs string, tenant *tenants.Tenant, provider string) utils.GenerationOptions {
+	_, span := tracing.Start(ctx, "prompt.build")
+	defer span.End()
+
+	opts := utils.GenerationOptions{
+		SchemaContext: utils.SchemaPromptContext(resource, specs),
+		Conventions:   config.Current().Prompts.Conventions,
+	}
+	span.SetAttributes(attribute.Bool("prompt.schema_grounded", opts.SchemaContext != ""))
+	if tenant != nil {
+		// Tenant conventions follow the house conventions so they can refine them
+		opts.Conventions = strings.TrimSpace(opts.Conventions + "\n\n" + tenant.PromptConventions)
+		span.SetAttributes(attribute.String("tenant", tenant.ID))
+		opts.APIKey = tenant.Credentials.For(provider)
+	}
+	return opts
+}
+
+// promptOverheadTokens approximates the system prompt and instructions wrapped around the request
+const promptOverheadTokens = 1000
+
+// usageEstimate returns the model a generation will use and the most tokens it can spend: the
+// prompt, at roughly four characters per token, and a completion of max_tokens
+func usageEstimate(provider, resource, specs string, opts utils.GenerationOptions) (string, utils.TokenUsage) {
+	settings, _ := config.Current().Providers.Get(provider)
+	prompt := (len(resource)+len(specs)+len(opts.SchemaContext)+len(opts.Conventions))/4 + promptOverheadTokens
+	return settings.Model, utils.TokenUsage{
+		PromptTokens:     prompt,
+		CompletionTokens: settings.MaxTokens,
+		TotalTokens:      prompt + settings.MaxTokens,
+	}
+}
+
+// observeValidation records a generation's validation outcome and policy findings in metrics
+func observeValidation(provider string, result *GenerationResult) {
+	if result.Validation == nil {
+		return
+	}
+	metrics.ObserveValidation(provider, result.Validation.IsValid)
+	for _, finding := range policyFindings(result.Validation) {
+		metrics.ObservePolicyFinding(provider, finding.Source, finding.Rule, finding.Severity)
+	}
+}
+
+// startGenerationSpan starts the span covering a whole generation run
+func startGenerationSpan(ctx context.Context, provider string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "generation", attribute.String("llm.provider", provider))
+}
+
+// endGenerationSpan records the model, token usage and validation outcome and ends the span
+func endGenerationSpan(span trace.Span, result *GenerationResult, err error) {
+	if result != nil {
+		span.SetAttributes(
+			attribute.String("llm.model", result.Provenance.Model),
+			attribute.Int("llm.tokens.total", result.Provenance.Usage.TotalTokens),
+		)
+		if result.Validation != nil {
+			span.SetAttributes(
+				attribute.Bool("validation.valid", result.Validation.IsValid),
+				attribute.Int("validation.errors", len(result.Validation.Errors)),
+			)
+		}
 	}
+	tracing.End(span, err)
+}
+
+// newProvenance records the inputs, model and timing of a generation
+func newProvenance(resource, specs, provider string, out *utils.GenerationOutput, client ClientInfo, startedAt time.Time) Provenance {
+	return Provenance{
+		Resource:              resource,
+		Specs:                 specs,
+		Provider:              provider,
+		Model:                 out.Model,
+		PromptTemplateVersion: out.PromptVersion,
+		Usage:                 out.Usage,
+		Client:                client,
+		StartedAt:             startedAt,
+		CompletedAt:           time.Now().UTC(),
+	}
+}
 
+// processGeneratedCode cleans, formats and validates raw model output
+func (s *TerraformService) processGeneratedCode(ctx context.Context, tfCode, resource, specs string, opts GenerateOptions) (*GenerationResult, error) {
 	// Validate generated code is not empty
 	if strings.TrimSpace(tfCode) == "" {
-		return "", nil, fmt.Errorf("generated terraform code is empty")
+		return nil, utils.NewRetryableError(utils.CodeEmptyOutput, "generated terraform code is empty", nil)
 	}
 
 	// Clean the code (remove markdown code block markers)
+	_, span := tracing.Start(ctx, "terraform.clean")
 	cleanedCode, err := s.CleanTerraformCode(tfCode)
+	tracing.End(span, err)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to clean terraform code: %w", err)
+		return nil, utils.NewRetryableError(utils.CodeEmptyOutput, "failed to clean terraform code", err)
+	}
+
+	result := &GenerationResult{Code: cleanedCode}
+
+	// Format the code; unparseable code is left as-is for terraform validate to report
+	format, err := utils.FormatTerraformCode(cleanedCode)
+	if err == nil {
+		result.Format = format
+		result.Code = format.FormattedCode
+	}
+
+	// Replace hard-coded AMI IDs with aws_ami lookups inferred from comments and specs
+	if code, replacements, err := utils.ReplaceHardcodedAMIs(result.Code, resource+" "+specs); err == nil {
+		result.Code = code
+		result.AMIReplacements = replacements
+	}
+
+	// Lift environment-specific literals into variables
+	if opts.ExtractVariables {
+		variables, err := utils.ExtractVariables(result.Code)
+		if err == nil && len(variables.Variables) > 0 {
+			result.Code = variables.Code
+			result.Variables = variables
+		}
+	}
+
+	// Split into the standard module layout
+	if opts.OutputMode == OutputModeModule {
+		variablesTF := ""
+		if result.Variables != nil {
+			variablesTF = result.Variables.VariablesTF
+		}
+		module, err := utils.BuildModuleLayout(result.Code, variablesTF, resource, specs)
+		if err == nil {
+			result.Module = module
+		}
 	}
 
 	// Validate the generated Terraform code
-	validation, err := utils.ValidateTerraformCode(cleanedCode)
+	validation, err := utils.ValidateTerraformFiles(ctx, result.Files(), s.validationOptions(opts.Lint))
 	if err != nil {
-		return cleanedCode, nil, fmt.Errorf("failed to validate terraform code: %w", err)
+		return result, fmt.Errorf("failed to validate terraform code: %w", err)
 	}
+	result.Validation = validation
 
-	return cleanedCode, validation, nil
+	return result, nil
 }
 
-// GenerateAndValidateWithCopilot generates terraform code using GitHub Copilot and validates it
-func (s *TerraformService) GenerateAndValidateWithCopilot(resource, specs string) (string, *utils.TerraformValidationResult, error) {
-	// Generate terraform code using GitHub Copilot
-	tfCode, err := utils.GenerateTerraformCodeWithCopilot(resource, specs)
+// ValidateCode formats and validates user-submitted terraform code
+func (s *TerraformService) ValidateCode(ctx context.Context, code string, opts ValidateOptions) (*utils.TerraformValidationResult, *utils.TerraformFormatResult, error) {
+	// Validate the provided Terraform code as submitted
+	validation, err := utils.ValidateTerraformCodeWithOptions(ctx, code, s.validationOptions(opts.Lint))
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to generate terraform code with GitHub Copilot: %w", err)
+		return nil, nil, fmt.Errorf("failed to validate terraform code: %w", err)
 	}
 
-	// Validate generated code is not empty
-	if strings.TrimSpace(tfCode) == "" {
-		return "", nil, fmt.Errorf("generated terraform code is empty")
+	format, err := utils.FormatTerraformCode(code)
+	if err != nil {
+		// Syntax errors are already reported by terraform validate
+		return validation, nil, nil
 	}
 
-	// Clean the code (remove markdown code block markers)
-	cleanedCode, err := s.CleanTerraformCode(tfCode)
+	if opts.CheckFormat && !format.IsFormatted {
+		validation.IsValid = false
+		validation.Errors = append(validation.Errors, "Terraform code is not canonically formatted (run terraform fmt)")
+	}
+
+	return validation, format, nil
+}
+
+// ExtractVariables lifts hard-coded values in existing terraform code into variables
+func (s *TerraformService) ExtractVariables(code string) (*utils.VariableExtractionResult, error) {
+	// Extraction works on the formatted code so the returned files are canonical
+	if format, err := utils.FormatTerraformCode(code); err == nil {
+		code = format.FormattedCode
+	}
+
+	result, err := utils.ExtractVariables(code)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to clean terraform code: %w", err)
+		return nil, utils.NewError(utils.CodeUnprocessable, "failed to extract variables", err)
 	}
 
-	// Validate the generated Terraform code
-	validation, err := utils.ValidateTerraformCode(cleanedCode)
+	return result, nil
+}
+
+// validationOptions resolves lint options into validation options; the require_lint policy turns
+// linting on for every request
+func (s *TerraformService) validationOptions(lint LintOptions) utils.ValidationOptions {
+	return utils.ValidationOptions{
+		Lint:        lint.Enabled || config.Current().Policies.RequireLint,
+		LintRuleset: s.ResolveLintRuleset(lint.Ruleset, lint.Tenant),
+	}
+}
+
+// ResolveLintRuleset picks the explicit ruleset, then the tenant's ruleset if one exists, then the default
+func (s *TerraformService) ResolveLintRuleset(requested, tenant string) string {
+	if strings.TrimSpace(requested) != "" {
+		return strings.TrimSpace(requested)
+	}
+	if tenant != "" && utils.LintRulesetExists(tenant) {
+		return tenant
+	}
+	return ""
+}
+
+// SaveGeneration saves a generation result as a flat file or, in module output mode, a module directory,
+// together with a metadata record describing how it was produced
+func (s *TerraformService) SaveGeneration(ctx context.Context, result *GenerationResult) (*ArtifactMetadata, error) {
+	return s.saveGeneration(ctx, "artifacts", s.artifactStore(), result)
+}
+
+// QuarantineGeneration saves an invalid generation and its diagnostics to the quarantine namespace
+func (s *TerraformService) QuarantineGeneration(ctx context.Context, result *GenerationResult) (*ArtifactMetadata, error) {
+	return s.saveGeneration(ctx, "quarantine", s.quarantineStore(), result)
+}
+
+// saveGeneration saves a generation result and its metadata record to a backend
+func (s *TerraformService) saveGeneration(ctx context.Context, namespace string, store storage.Storage, result *GenerationResult) (metadata *ArtifactMetadata, err error) {
+	_, span := tracing.Start(ctx, "artifact.save", attribute.String("artifact.namespace", namespace))
+	defer func() {
+		if metadata != nil {
+			span.SetAttributes(attribute.String("artifact.id", metadata.ID))
+		}
+		tracing.End(span, err)
+	}()
+
+	var artifact *storage.SavedArtifact
+	if result.Module != nil {
+		artifact, err = s.saveModule(store, result.Files(), result.Provenance.Resource, result.Provenance.Provider)
+	} else {
+		artifact, err = s.saveFile(store, result.CombinedCode(), result.Provenance.Resource, result.Provenance.Provider)
+	}
 	if err != nil {
-		return cleanedCode, nil, fmt.Errorf("failed to validate terraform code: %w", err)
+		return nil, err
 	}
 
-	return cleanedCode, validation, nil
+	metadata = newArtifactMetadata(artifact, result)
+	if err := putMetadata(store, metadata); err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
 }
 
 // SaveTerraformFile saves terraform code to a file with provider prefix
-func (s *TerraformService) SaveTerraformFile(code, resource, provider string) (string, error) {
-	// Ensure tf-generated-files directory exists
-	terraformDir := "tf-generated-files"
-	if err := os.MkdirAll(terraformDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create tf-generated-files directory: %w", err)
+func (s *TerraformService) SaveTerraformFile(code, resource, provider string) (*storage.SavedArtifact, error) {
+	return s.saveFile(s.artifactStore(), code, resource, provider)
+}
+
+// SaveTerraformModule saves a generated module as a directory with provider prefix
+func (s *TerraformService) SaveTerraformModule(files map[string]string, resource, provider string) (*storage.SavedArtifact, error) {
+	return s.saveModule(s.artifactStore(), files, resource, provider)
+}
+
+// saveFile saves terraform code as a single-file artifact on a backend
+func (s *TerraformService) saveFile(store storage.Storage, code, resource, provider string) (*storage.SavedArtifact, error) {
+	baseName, err := s.ArtifactBaseName(resource, provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate unique filename: %w", err)
 	}
 
-	// Get next available filename with provider prefix
-	filePath, err := s.GetNextAvailableFilename(terraformDir, resource, provider, ".tf")
+	artifact, err := store.SaveFile(context.Background(), baseName, ".tf", []byte(code))
 	if err != nil {
-		return "", fmt.Errorf("failed to generate unique filename: %w", err)
+		return nil, utils.NewError(utils.CodeStorageError, "failed to write terraform file", err)
 	}
 
-	// Write file
-	if err := os.WriteFile(filePath, []byte(code), 0644); err != nil {
-		return "", fmt.Errorf("failed to write terraform file: %w", err)
+	return artifact, nil
+}
+
+// saveModule saves a generated module as a directory artifact on a backend
+func (s *TerraformService) saveModule(store storage.Storage, files map[string]string, resource, provider string) (*storage.SavedArtifact, error) {
+	baseName, err := s.ArtifactBaseName(resource, provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate unique directory name: %w", err)
 	}
 
-	return filePath, nil
+	contents := make(map[string][]byte, len(files))
+	for name, content := range files {
+		contents[name] = []byte(content)
+	}
+
+	artifact, err := store.SaveDir(context.Background(), baseName, contents)
+	if err != nil {
+		return nil, utils.NewError(utils.CodeStorageError, "failed to write terraform module", err)
+	}
+
+	return artifact, nil
 }
 
 // CleanTerraformCode removes markdown code block markers
@@ -124,14 +506,8 @@ func (s *TerraformService) CleanTerraformCode(code string) (string, error) {
 	return result, nil
 }
 
-// GetNextAvailableFilename generates a unique filename with provider prefix in the specified directory
-func (s *TerraformService) GetNextAvailableFilename(dir, resourceText, provider, ext string) (string, error) {
-	if dir == "" {
-		return "", fmt.Errorf("directory cannot be empty")
-	}
-	if ext == "" {
-		return "", fmt.Errorf("extension cannot be empty")
-	}
+// ArtifactBaseName builds the <provider>_<first five resource words> prefix of artifact names
+func (s *TerraformService) ArtifactBaseName(resourceText, provider string) (string, error) {
 	if provider == "" {
 		return "", fmt.Errorf("provider cannot be empty")
 	}
@@ -156,18 +532,5 @@ func (s *TerraformService) GetNextAvailableFilename(dir, resourceText, provider,
 	}
 
 	// Add provider prefix to the base name
-	baseNameWithProvider := fmt.Sprintf("%s_%s", provider, baseName)
-
-	// Find next available filename (with safety limit to prevent infinite loop)
-	maxAttempts := 10000
-	for index := 1; index <= maxAttempts; index++ {
-		fileName := fmt.Sprintf("%s_%d%s", baseNameWithProvider, index, ext)
-		filePath := filepath.Join(dir, fileName)
-
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			return filePath, nil
-		}
-	}
-
-	return "", fmt.Errorf("failed to find available filename after %d attempts", maxAttempts)
+	return fmt.Sprintf("%s_%s", provider, baseName), nil
 }
@@ -0,0 +1,437 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// metadataSuffix names the JSON sidecar stored next to each artifact
+const metadataSuffix = ".meta.json"
+
+// deletedDir holds an empty tombstone named after each deleted artifact, so the index of a
+// deleted artifact is still seen when seeding and never handed out again
+const deletedDir = ".deleted"
+
+// tempPrefix marks in-progress writes; such entries are never treated as artifacts
+const tempPrefix = ".tmp-"
+
+// staleTempAge is how old an in-progress write must be before it is treated as a crash leftover
+const staleTempAge = time.Hour
+
+// maxClaimAttempts bounds retries when another process claims the same name first
+const maxClaimAttempts = 100
+
+// indexedNamePattern splits an artifact name into base name, index and optional extension
+var indexedNamePattern = regexp.MustCompile(`^(.+)_(\d+)(\.[A-Za-z0-9]+)?$`)
+
+// FilesystemStore saves artifacts under a local directory.
+// Names are <base>_<index><ext>; the next index per base name is kept in memory,
+// seeded by a single scan of the directory and its tombstones, and names are claimed with
+// exclusive creation.
+type FilesystemStore struct {
+	dir string
+
+	mu      sync.Mutex
+	seeded  bool
+	nextIdx map[string]int // base name -> next index; files and directories share one sequence
+}
+
+// NewFilesystemStore creates a store rooted at dir
+func NewFilesystemStore(dir string) *FilesystemStore {
+	return &FilesystemStore{
+		dir:     dir,
+		nextIdx: map[string]int{},
+	}
+}
+
+// Dir returns the root directory of the store
+func (s *FilesystemStore) Dir() string {
+	return s.dir
+}
+
+// Name returns the backend name
+func (s *FilesystemStore) Name() string {
+	return "filesystem"
+}
+
+// Ping checks that the directory exists and is writable
+func (s *FilesystemStore) Ping(ctx context.Context) error {
+	if err := s.ensureDir(); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(s.dir, tempPrefix+"ping-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", s.dir, err)
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// SaveFile atomically writes content to a new <base>_<index><ext> file and returns its path
+func (s *FilesystemStore) SaveFile(ctx context.Context, baseName, ext string, content []byte) (*SavedArtifact, error) {
+	if err := s.ensureDir(); err != nil {
+		return nil, err
+	}
+
+	// Write the full content to a temp file first so a crash never leaves a truncated artifact
+	tempPath, err := s.writeTempFile(content)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tempPath)
+
+	for attempt := 0; attempt < maxClaimAttempts; attempt++ {
+		id := fmt.Sprintf("%s_%d", baseName, s.claimIndex(baseName))
+		finalPath := filepath.Join(s.dir, id+ext)
+
+		// Link fails if the name exists, which makes it an exclusive, all-or-nothing publish
+		err := os.Link(tempPath, finalPath)
+		if err == nil {
+			return &SavedArtifact{ID: id, Location: finalPath}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to publish file: %w", err)
+		}
+	}
+
+	return nil, fmt.Errorf("failed to claim a unique name for %s after %d attempts", baseName, maxClaimAttempts)
+}
+
+// SaveDir atomically writes files to a new <base>_<index> directory and returns its path
+func (s *FilesystemStore) SaveDir(ctx context.Context, baseName string, files map[string][]byte) (*SavedArtifact, error) {
+	if err := s.ensureDir(); err != nil {
+		return nil, err
+	}
+
+	tempDir, err := os.MkdirTemp(s.dir, tempPrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for name, content := range files {
+		if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+			return nil, fmt.Errorf("invalid file name %q", name)
+		}
+		if err := writeFileSync(filepath.Join(tempDir, name), content); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.Chmod(tempDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to set directory permissions: %w", err)
+	}
+
+	for attempt := 0; attempt < maxClaimAttempts; attempt++ {
+		id := fmt.Sprintf("%s_%d", baseName, s.claimIndex(baseName))
+		finalPath := filepath.Join(s.dir, id)
+
+		// Rename refuses to replace an existing non-empty directory, so the complete module appears at once or not at all
+		err := os.Rename(tempDir, finalPath)
+		if err == nil {
+			return &SavedArtifact{ID: id, Location: finalPath}, nil
+		}
+		if !errors.Is(err, os.ErrExist) && !errors.Is(err, syscall.ENOTEMPTY) {
+			return nil, fmt.Errorf("failed to publish directory: %w", err)
+		}
+	}
+
+	return nil, fmt.Errorf("failed to claim a unique name for %s after %d attempts", baseName, maxClaimAttempts)
+}
+
+// PutMetadata atomically writes the <id>.meta.json sidecar next to the artifact
+func (s *FilesystemStore) PutMetadata(ctx context.Context, id string, metadata []byte) error {
+	if !ValidID(id) {
+		return fmt.Errorf("invalid artifact id %q", id)
+	}
+	if err := s.ensureDir(); err != nil {
+		return err
+	}
+
+	tempPath, err := s.writeTempFile(metadata)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, filepath.Join(s.dir, id+metadataSuffix)); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to publish metadata: %w", err)
+	}
+	return nil
+}
+
+// GetMetadata reads the <id>.meta.json sidecar
+func (s *FilesystemStore) GetMetadata(ctx context.Context, id string) ([]byte, error) {
+	if !ValidID(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, id+metadataSuffix))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	return data, nil
+}
+
+// List returns every artifact in the directory, skipping metadata sidecars and in-progress writes
+func (s *FilesystemStore) List(ctx context.Context) ([]ArtifactInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s directory: %w", s.dir, err)
+	}
+
+	var artifacts []ArtifactInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, tempPrefix) || strings.HasSuffix(name, metadataSuffix) {
+			continue
+		}
+		match := indexedNamePattern.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+		info, err := s.artifactInfo(strings.TrimSuffix(name, match[3]), name, entry.IsDir())
+		if err != nil {
+			continue // removed while listing
+		}
+		artifacts = append(artifacts, *info)
+	}
+	return artifacts, nil
+}
+
+// Get reads an artifact file or module directory
+func (s *FilesystemStore) Get(ctx context.Context, id string) (*Artifact, error) {
+	name, isDir, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.artifactInfo(id, name, isDir)
+	if err != nil {
+		return nil, err
+	}
+
+	artifact := &Artifact{ArtifactInfo: *info, Files: map[string][]byte{}}
+	if !isDir {
+		content, err := os.ReadFile(info.Location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		artifact.Files[name] = content
+		return artifact, nil
+	}
+
+	entries, err := os.ReadDir(info.Location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(info.Location, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s/%s: %w", name, entry.Name(), err)
+		}
+		artifact.Files[entry.Name()] = content
+	}
+	return artifact, nil
+}
+
+// Delete removes an artifact and its metadata sidecar, leaving a tombstone that keeps its index
+func (s *FilesystemStore) Delete(ctx context.Context, id string) error {
+	name, _, err := s.find(id)
+	if err != nil {
+		return err
+	}
+	// The tombstone is written first, so a crash part way through cannot free the index
+	if err := os.MkdirAll(filepath.Join(s.dir, deletedDir), 0755); err != nil {
+		return fmt.Errorf("failed to create %s directory: %w", deletedDir, err)
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, deletedDir, id), nil, 0644); err != nil {
+		return fmt.Errorf("failed to record deletion of %s: %w", id, err)
+	}
+	if err := os.RemoveAll(filepath.Join(s.dir, name)); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", name, err)
+	}
+	if err := os.Remove(filepath.Join(s.dir, id+metadataSuffix)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete metadata of %s: %w", id, err)
+	}
+	return nil
+}
+
+// find returns the directory entry name of an artifact and whether it is a module directory
+func (s *FilesystemStore) find(id string) (string, bool, error) {
+	if !ValidID(id) {
+		return "", false, ErrNotFound
+	}
+
+	if info, err := os.Stat(filepath.Join(s.dir, id)); err == nil && info.IsDir() {
+		return id, true, nil
+	}
+
+	// IDs contain no glob metacharacters, so the pattern only matches <id>.<ext>
+	matches, err := filepath.Glob(filepath.Join(s.dir, id+".*"))
+	if err != nil {
+		return "", false, fmt.Errorf("failed to look up %s: %w", id, err)
+	}
+	for _, match := range matches {
+		name := filepath.Base(match)
+		if !strings.HasSuffix(name, metadataSuffix) && indexedNamePattern.MatchString(name) {
+			return name, false, nil
+		}
+	}
+	return "", false, ErrNotFound
+}
+
+// artifactInfo stats an artifact entry; the size of a module is the sum of its files
+func (s *FilesystemStore) artifactInfo(id, name string, isDir bool) (*ArtifactInfo, error) {
+	location := filepath.Join(s.dir, name)
+	stat, err := os.Stat(location)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ArtifactInfo{
+		ID:        id,
+		Kind:      KindFile,
+		Location:  location,
+		Size:      stat.Size(),
+		CreatedAt: stat.ModTime().UTC(),
+	}
+	if isDir {
+		info.Kind = KindModule
+		info.Size = 0
+		entries, err := os.ReadDir(location)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if fileInfo, err := entry.Info(); err == nil && !entry.IsDir() {
+				info.Size += fileInfo.Size()
+			}
+		}
+	}
+	return info, nil
+}
+
+// claimIndex returns the next index for a base name and advances the counter
+func (s *FilesystemStore) claimIndex(baseName string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.nextIdx[baseName]
+	if index < 1 {
+		index = 1
+	}
+	s.nextIdx[baseName] = index + 1
+	return index
+}
+
+// ensureDir creates the store directory and seeds the index from its entries and tombstones
+func (s *FilesystemStore) ensureDir() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seeded {
+		return nil
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s directory: %w", s.dir, err)
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read %s directory: %w", s.dir, err)
+	}
+	tombstones, err := os.ReadDir(filepath.Join(s.dir, deletedDir))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s directory: %w", deletedDir, err)
+	}
+
+	for _, entry := range append(entries, tombstones...) {
+		name := entry.Name()
+
+		// Leftovers from a crash mid-write are removed; recent ones may belong to another process
+		if strings.HasPrefix(name, tempPrefix) {
+			if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > staleTempAge {
+				os.RemoveAll(filepath.Join(s.dir, name))
+			}
+			continue
+		}
+
+		match := indexedNamePattern.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+		index, err := strconv.Atoi(match[2])
+		if err != nil {
+			continue
+		}
+		if index >= s.nextIdx[match[1]] {
+			s.nextIdx[match[1]] = index + 1
+		}
+	}
+
+	s.seeded = true
+	return nil
+}
+
+// writeTempFile writes content to a synced temp file in the store directory
+func (s *FilesystemStore) writeTempFile(content []byte) (string, error) {
+	file, err := os.CreateTemp(s.dir, tempPrefix+"*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tempPath := file.Name()
+
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return "", fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return "", fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Chmod(tempPath, 0644); err != nil {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("failed to set file permissions: %w", err)
+	}
+
+	return tempPath, nil
+}
+
+// writeFileSync writes a file and flushes it to disk
+func writeFileSync(path string, content []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Base(path), err)
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync %s: %w", filepath.Base(path), err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,466 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config configures an S3-compatible object store (AWS S3, MinIO, ...)
+type S3Config struct {
+	Endpoint        string // host[:port], e.g. s3.amazonaws.com or localhost:9000
+	Bucket          string
+	Prefix          string // optional key prefix, e.g. "artifacts/"
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	UseSSL          bool
+}
+
+// Marker objects of a module artifact; file names starting with "." are never artifact files
+const (
+	claimObject    = ".claim"    // created first with a conditional put to reserve the ID
+	manifestObject = ".manifest" // written after every file; modules without one are not listed
+)
+
+// S3Store saves artifacts as objects in an S3-compatible bucket.
+// A file artifact is one object; a module artifact is one object per file under a common prefix.
+// Names are claimed with conditional puts (If-None-Match: *), so concurrent writers, even in
+// other processes, never overwrite each other's artifacts.
+type S3Store struct {
+	client *minio.Client
+	bucket string
+	prefix string
+
+	mu      sync.Mutex
+	nextIdx map[string]int // base name -> next index, seeded by one prefix listing per base name
+}
+
+// NewS3Store creates an S3 store and its client
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("storage.s3.endpoint is required for the s3 storage backend")
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("storage.s3.bucket is required for the s3 storage backend")
+	}
+
+	transport, err := minio.DefaultTransport(cfg.UseSSL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 transport: %w", err)
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:     credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		Secure:    cfg.UseSSL,
+		Region:    cfg.Region,
+		Transport: createOnlyTransport{base: transport},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	prefix := cfg.Prefix
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return &S3Store{
+		client:  client,
+		bucket:  cfg.Bucket,
+		prefix:  prefix,
+		nextIdx: map[string]int{},
+	}, nil
+}
+
+// Name returns the backend name
+func (s *S3Store) Name() string {
+	return "s3"
+}
+
+// Ping checks that the bucket exists and is reachable
+func (s *S3Store) Ping(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("failed to reach bucket %s: %w", s.bucket, err)
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", s.bucket)
+	}
+	return nil
+}
+
+// SaveFile uploads a single-file artifact and returns its s3:// location
+func (s *S3Store) SaveFile(ctx context.Context, baseName, ext string, content []byte) (*SavedArtifact, error) {
+	for attempt := 0; attempt < maxClaimAttempts; attempt++ {
+		index, err := s.claimIndex(ctx, baseName)
+		if err != nil {
+			return nil, err
+		}
+
+		id := fmt.Sprintf("%s_%d", baseName, index)
+		key := s.prefix + id + ext
+
+		// A single conditional PUT is atomic: readers see the whole object or nothing, and it
+		// fails instead of replacing an object another writer created first
+		created, err := s.putNew(ctx, key, content)
+		if err != nil {
+			return nil, err
+		}
+		if !created {
+			continue
+		}
+		return &SavedArtifact{ID: id, Location: fmt.Sprintf("s3://%s/%s", s.bucket, key)}, nil
+	}
+
+	return nil, fmt.Errorf("failed to claim a unique name for %s after %d attempts", baseName, maxClaimAttempts)
+}
+
+// SaveDir uploads every file of a module artifact under a common prefix and returns its s3:// location
+func (s *S3Store) SaveDir(ctx context.Context, baseName string, files map[string][]byte) (*SavedArtifact, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if name != path.Base(name) || strings.HasPrefix(name, ".") {
+			return nil, fmt.Errorf("invalid file name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for attempt := 0; attempt < maxClaimAttempts; attempt++ {
+		index, err := s.claimIndex(ctx, baseName)
+		if err != nil {
+			return nil, err
+		}
+
+		id := fmt.Sprintf("%s_%d", baseName, index)
+		dirKey := s.prefix + id + "/"
+		taken, err := s.prefixExists(ctx, dirKey)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			continue
+		}
+		created, err := s.putNew(ctx, dirKey+claimObject, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !created {
+			continue
+		}
+
+		for _, name := range names {
+			if err := s.put(ctx, dirKey+name, files[name]); err != nil {
+				return nil, err
+			}
+		}
+		// The manifest publishes the module: until it exists, List and Get ignore the files
+		manifest, err := json.Marshal(names)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.put(ctx, dirKey+manifestObject, manifest); err != nil {
+			return nil, err
+		}
+		return &SavedArtifact{ID: id, Location: fmt.Sprintf("s3://%s/%s", s.bucket, dirKey)}, nil
+	}
+
+	return nil, fmt.Errorf("failed to claim a unique name for %s after %d attempts", baseName, maxClaimAttempts)
+}
+
+// PutMetadata uploads the <id>.meta.json object next to the artifact
+func (s *S3Store) PutMetadata(ctx context.Context, id string, metadata []byte) error {
+	if !ValidID(id) {
+		return fmt.Errorf("invalid artifact id %q", id)
+	}
+	return s.put(ctx, s.prefix+id+metadataSuffix, metadata)
+}
+
+// GetMetadata downloads the <id>.meta.json object
+func (s *S3Store) GetMetadata(ctx context.Context, id string) ([]byte, error) {
+	if !ValidID(id) {
+		return nil, ErrNotFound
+	}
+	return s.get(ctx, s.prefix+id+metadataSuffix)
+}
+
+// List returns every artifact under the prefix, grouping module files by their directory.
+// Modules still being written (without a manifest) are left out.
+func (s *S3Store) List(ctx context.Context) ([]ArtifactInfo, error) {
+	byID := map[string]*ArtifactInfo{}
+	published := map[string]bool{}
+	var order []string
+
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list artifacts: %w", object.Err)
+		}
+		id, kind, marker, ok := s.parseKey(object.Key)
+		if !ok {
+			continue
+		}
+		if marker {
+			if path.Base(object.Key) == manifestObject {
+				published[id] = true
+			}
+			continue
+		}
+
+		info, seen := byID[id]
+		if !seen {
+			info = &ArtifactInfo{ID: id, Kind: kind, Location: s.location(id, kind, object.Key), CreatedAt: object.LastModified.UTC()}
+			byID[id] = info
+			order = append(order, id)
+		}
+		info.Size += object.Size
+		if object.LastModified.Before(info.CreatedAt) {
+			info.CreatedAt = object.LastModified.UTC()
+		}
+	}
+
+	artifacts := make([]ArtifactInfo, 0, len(order))
+	for _, id := range order {
+		if info := byID[id]; info.Kind == KindFile || published[id] {
+			artifacts = append(artifacts, *info)
+		}
+	}
+	return artifacts, nil
+}
+
+// Get downloads every object of an artifact
+func (s *S3Store) Get(ctx context.Context, id string) (*Artifact, error) {
+	keys, _, kind, err := s.artifactKeys(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	artifact := &Artifact{Files: map[string][]byte{}}
+	artifact.ID = id
+	artifact.Kind = kind
+	artifact.Location = s.location(id, kind, keys[0])
+	for _, key := range keys {
+		content, err := s.get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		artifact.Files[path.Base(key)] = content
+		artifact.Size += int64(len(content))
+	}
+
+	if stat, err := s.client.StatObject(ctx, s.bucket, keys[0], minio.StatObjectOptions{}); err == nil {
+		artifact.CreatedAt = stat.LastModified.UTC()
+	}
+	return artifact, nil
+}
+
+// Delete removes every object of an artifact and its metadata object, leaving a tombstone under
+// .deleted/ that keeps its index. The manifest goes first so a partly deleted module is no longer listed.
+func (s *S3Store) Delete(ctx context.Context, id string) error {
+	keys, markers, _, err := s.artifactKeys(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// The tombstone is written first, so a crash part way through cannot free the index
+	if err := s.put(ctx, s.prefix+deletedDir+"/"+id, nil); err != nil {
+		return fmt.Errorf("failed to record deletion of %s: %w", id, err)
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(markers))) // .manifest before .claim
+	keys = append(append(markers, keys...), s.prefix+id+metadataSuffix)
+	for _, key := range keys {
+		if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// artifactKeys returns the file keys and marker keys of an artifact and its kind. A module that
+// has no manifest yet is reported as not found.
+func (s *S3Store) artifactKeys(ctx context.Context, id string) ([]string, []string, string, error) {
+	if !ValidID(id) {
+		return nil, nil, "", ErrNotFound
+	}
+
+	var keys, markers []string
+	kind := ""
+	published := false
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix + id, Recursive: true}) {
+		if object.Err != nil {
+			return nil, nil, "", fmt.Errorf("failed to look up %s: %w", id, object.Err)
+		}
+		// The prefix also matches longer IDs such as <id>0, which parseKey filters out
+		objectID, objectKind, marker, ok := s.parseKey(object.Key)
+		if !ok || objectID != id {
+			continue
+		}
+		kind = objectKind
+		if marker {
+			markers = append(markers, object.Key)
+			published = published || path.Base(object.Key) == manifestObject
+			continue
+		}
+		keys = append(keys, object.Key)
+	}
+	if len(keys) == 0 || (kind == KindModule && !published) {
+		return nil, nil, "", ErrNotFound
+	}
+	sort.Strings(keys)
+	return keys, markers, kind, nil
+}
+
+// parseKey maps an object key to its artifact ID and kind, and reports whether it is a module's
+// marker object; metadata and unrelated objects are skipped
+func (s *S3Store) parseKey(key string) (id, kind string, marker, ok bool) {
+	name := strings.TrimPrefix(key, s.prefix)
+	if strings.HasSuffix(name, metadataSuffix) {
+		return "", "", false, false
+	}
+
+	if dir, file, found := strings.Cut(name, "/"); found {
+		return dir, KindModule, strings.HasPrefix(file, "."), ValidID(dir)
+	}
+
+	match := indexedNamePattern.FindStringSubmatch(name)
+	if match == nil || match[3] == "" {
+		return "", "", false, false
+	}
+	id = strings.TrimSuffix(name, match[3])
+	return id, KindFile, false, ValidID(id)
+}
+
+// location returns the s3:// location of an artifact given one of its keys
+func (s *S3Store) location(id, kind, key string) string {
+	if kind == KindModule {
+		return fmt.Sprintf("s3://%s/%s%s/", s.bucket, s.prefix, id)
+	}
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key)
+}
+
+// claimIndex returns the next index for a base name, listing existing objects and the tombstones
+// of deleted ones the first time
+func (s *S3Store) claimIndex(ctx context.Context, baseName string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, ok := s.nextIdx[baseName]
+	if !ok {
+		index = 1
+		for _, dir := range []string{s.prefix, s.prefix + deletedDir + "/"} {
+			for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: dir + baseName + "_"}) {
+				if object.Err != nil {
+					return 0, fmt.Errorf("failed to list artifacts: %w", object.Err)
+				}
+				name := strings.TrimSuffix(strings.TrimPrefix(object.Key, dir), "/")
+				match := indexedNamePattern.FindStringSubmatch(name)
+				if match == nil || match[1] != baseName {
+					continue
+				}
+				if existing, err := strconv.Atoi(match[2]); err == nil && existing >= index {
+					index = existing + 1
+				}
+			}
+		}
+	}
+
+	s.nextIdx[baseName] = index + 1
+	return index, nil
+}
+
+// putNew uploads one object only if the key does not exist yet; created is false when another
+// writer got there first
+func (s *S3Store) putNew(ctx context.Context, key string, content []byte) (created bool, err error) {
+	err = s.put(context.WithValue(ctx, createOnlyKey{}, true), key, content)
+	if err == nil {
+		return true, nil
+	}
+	// 412 when the object exists, 409 when a concurrent conditional write to it is in progress
+	var response minio.ErrorResponse
+	if errors.As(err, &response) && (response.StatusCode == http.StatusPreconditionFailed || response.StatusCode == http.StatusConflict) {
+		return false, nil
+	}
+	return false, err
+}
+
+// createOnlyKey marks an upload's context so createOnlyTransport makes it conditional
+type createOnlyKey struct{}
+
+// createOnlyTransport adds If-None-Match: * to marked uploads. minio-go can only send a quoted ETag
+// there, so the header is added here; it is outside the signature, which S3 allows for headers
+// other than x-amz-*.
+type createOnlyTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t createOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodPut && req.Context().Value(createOnlyKey{}) != nil {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", "*")
+	}
+	return t.base.RoundTrip(req)
+}
+
+// prefixExists reports whether any object exists under a key prefix
+func (s *S3Store) prefixExists(ctx context.Context, prefix string) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, MaxKeys: 1}) {
+		if object.Err != nil {
+			return false, fmt.Errorf("failed to check artifact %s: %w", prefix, object.Err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// get downloads one object, returning ErrNotFound when it does not exist
+func (s *S3Store) get(ctx context.Context, key string) ([]byte, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// put uploads one object
+func (s *S3Store) put(ctx context.Context, key string, content []byte) error {
+	contentType := "text/plain"
+	switch {
+	case strings.HasSuffix(key, ".md"):
+		contentType = "text/markdown"
+	case strings.HasSuffix(key, ".json"):
+		contentType = "application/json"
+	}
+
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(content), int64(len(content)), minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
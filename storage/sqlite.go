@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // pure Go driver, works with CGO_ENABLED=0
+)
+
+// sqliteSchema creates the artifact tables
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS artifacts (
+	id         TEXT PRIMARY KEY,
+	base_name  TEXT NOT NULL,
+	idx        INTEGER NOT NULL,
+	kind       TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	UNIQUE (base_name, idx)
+);
+
+CREATE TABLE IF NOT EXISTS artifact_files (
+	artifact_id TEXT NOT NULL REFERENCES artifacts(id) ON DELETE CASCADE,
+	name        TEXT NOT NULL,
+	content     BLOB NOT NULL,
+	PRIMARY KEY (artifact_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS artifact_counters (
+	base_name TEXT PRIMARY KEY,
+	last_idx  INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS artifact_metadata (
+	artifact_id TEXT PRIMARY KEY REFERENCES artifacts(id) ON DELETE CASCADE,
+	data        TEXT NOT NULL
+);
+`
+
+// SQLiteStore saves artifacts in an embedded SQLite database.
+// Index allocation and the write happen in one immediate transaction, and the highest index per
+// base name is kept in artifact_counters, so names are never reused, even after a delete.
+type SQLiteStore struct {
+	db   *sql.DB
+	path string
+}
+
+// NewSQLiteStore opens (or creates) the database at path
+func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	dsn := fmt.Sprintf("file:%s?_txlock=immediate&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)", dbPath)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create sqlite schema: %w", err)
+	}
+
+	return &SQLiteStore{db: db, path: dbPath}, nil
+}
+
+// Name returns the backend name
+func (s *SQLiteStore) Name() string {
+	return "sqlite"
+}
+
+// Ping checks that the database is reachable
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// SaveFile stores a single-file artifact and returns its sqlite:// location
+func (s *SQLiteStore) SaveFile(ctx context.Context, baseName, ext string, content []byte) (*SavedArtifact, error) {
+	return s.save(ctx, baseName, KindFile, func(id string) map[string][]byte {
+		return map[string][]byte{id + ext: content}
+	})
+}
+
+// SaveDir stores a multi-file artifact and returns its sqlite:// location
+func (s *SQLiteStore) SaveDir(ctx context.Context, baseName string, files map[string][]byte) (*SavedArtifact, error) {
+	for name := range files {
+		if name != path.Base(name) || strings.HasPrefix(name, ".") {
+			return nil, fmt.Errorf("invalid file name %q", name)
+		}
+	}
+	return s.save(ctx, baseName, KindModule, func(string) map[string][]byte {
+		return files
+	})
+}
+
+// save allocates the next index and writes the artifact rows in a single transaction
+func (s *SQLiteStore) save(ctx context.Context, baseName, kind string, filesFor func(id string) map[string][]byte) (*SavedArtifact, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Databases created before artifact_counters existed are caught up from the artifacts table
+	var index int
+	if err := tx.QueryRowContext(ctx,
+		`INSERT INTO artifact_counters (base_name, last_idx)
+		 VALUES (?1, (SELECT COALESCE(MAX(idx), 0) FROM artifacts WHERE base_name = ?1) + 1)
+		 ON CONFLICT (base_name) DO UPDATE SET last_idx = MAX(last_idx, (SELECT COALESCE(MAX(idx), 0) FROM artifacts WHERE base_name = ?1)) + 1
+		 RETURNING last_idx`, baseName,
+	).Scan(&index); err != nil {
+		return nil, fmt.Errorf("failed to allocate artifact index: %w", err)
+	}
+
+	id := fmt.Sprintf("%s_%d", baseName, index)
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO artifacts (id, base_name, idx, kind, created_at) VALUES (?, ?, ?, ?, ?)`,
+		id, baseName, index, kind, time.Now().UTC(),
+	); err != nil {
+		return nil, fmt.Errorf("failed to insert artifact: %w", err)
+	}
+
+	for name, content := range filesFor(id) {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO artifact_files (artifact_id, name, content) VALUES (?, ?, ?)`,
+			id, name, content,
+		); err != nil {
+			return nil, fmt.Errorf("failed to insert artifact file %s: %w", name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit artifact: %w", err)
+	}
+
+	return &SavedArtifact{ID: id, Location: s.location(id)}, nil
+}
+
+// PutMetadata stores the metadata record of an artifact
+func (s *SQLiteStore) PutMetadata(ctx context.Context, id string, metadata []byte) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO artifact_metadata (artifact_id, data) VALUES (?, ?)
+		 ON CONFLICT (artifact_id) DO UPDATE SET data = excluded.data`,
+		id, string(metadata),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store metadata: %w", err)
+	}
+	return nil
+}
+
+// GetMetadata returns the metadata record of an artifact
+func (s *SQLiteStore) GetMetadata(ctx context.Context, id string) ([]byte, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM artifact_metadata WHERE artifact_id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	return []byte(data), nil
+}
+
+// List returns every stored artifact with the total size of its files
+func (s *SQLiteStore) List(ctx context.Context) ([]ArtifactInfo, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT a.id, a.kind, a.created_at, COALESCE(SUM(LENGTH(f.content)), 0)
+		 FROM artifacts a LEFT JOIN artifact_files f ON f.artifact_id = a.id
+		 GROUP BY a.id ORDER BY a.created_at, a.id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+	defer rows.Close()
+
+	var artifacts []ArtifactInfo
+	for rows.Next() {
+		var info ArtifactInfo
+		if err := rows.Scan(&info.ID, &info.Kind, &info.CreatedAt, &info.Size); err != nil {
+			return nil, fmt.Errorf("failed to read artifact row: %w", err)
+		}
+		info.Location = s.location(info.ID)
+		artifacts = append(artifacts, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+	return artifacts, nil
+}
+
+// Get returns an artifact and its files
+func (s *SQLiteStore) Get(ctx context.Context, id string) (*Artifact, error) {
+	artifact := &Artifact{Files: map[string][]byte{}}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, kind, created_at FROM artifacts WHERE id = ?`, id,
+	).Scan(&artifact.ID, &artifact.Kind, &artifact.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+	artifact.Location = s.location(id)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT name, content FROM artifact_files WHERE artifact_id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact files: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var content []byte
+		if err := rows.Scan(&name, &content); err != nil {
+			return nil, fmt.Errorf("failed to read artifact file: %w", err)
+		}
+		artifact.Files[name] = content
+		artifact.Size += int64(len(content))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read artifact files: %w", err)
+	}
+	return artifact, nil
+}
+
+// Delete removes an artifact; its files and metadata are removed by the foreign key cascade
+func (s *SQLiteStore) Delete(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM artifacts WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete artifact: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// location returns the sqlite:// location of an artifact
+func (s *SQLiteStore) location(id string) string {
+	return fmt.Sprintf("sqlite://%s#%s", s.path, id)
+}
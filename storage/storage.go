@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-autopilot/config"
+)
+
+// ErrNotFound is returned when an artifact or its metadata does not exist
+var ErrNotFound = errors.New("artifact not found")
+
+// artifactIDPattern matches artifact IDs such as openai_ec2_instance_1
+var artifactIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*_\d+$`)
+
+// ValidID reports whether id is a well-formed artifact ID
+func ValidID(id string) bool {
+	return artifactIDPattern.MatchString(id)
+}
+
+// SavedArtifact identifies a stored artifact
+type SavedArtifact struct {
+	ID       string `json:"id"`       // <baseName>_<index>, unique within the backend
+	Location string `json:"location"` // backend-specific path or URL
+}
+
+// Artifact kinds
+const (
+	KindFile   = "file"   // a single file, <id><ext>
+	KindModule = "module" // a set of files under <id>
+)
+
+// ArtifactInfo describes a stored artifact without its content
+type ArtifactInfo struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Location  string    `json:"location"`
+	Size      int64     `json:"size"` // total bytes of all files
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Artifact is a stored artifact together with its files
+type Artifact struct {
+	ArtifactInfo
+	Files map[string][]byte // file name -> content; a file artifact has a single <id><ext> entry
+}
+
+// Storage saves generated artifacts.
+// A file artifact is stored as <baseName>_<index><ext>; a module artifact is a set of
+// files under <baseName>_<index>. Implementations must never reuse an index.
+type Storage interface {
+	// SaveFile stores a single-file artifact
+	SaveFile(ctx context.Context, baseName, ext string, content []byte) (*SavedArtifact, error)
+
+	// SaveDir stores a multi-file artifact
+	SaveDir(ctx context.Context, baseName string, files map[string][]byte) (*SavedArtifact, error)
+
+	// PutMetadata stores (or replaces) the JSON metadata record of an artifact
+	PutMetadata(ctx context.Context, id string, metadata []byte) error
+
+	// GetMetadata returns the JSON metadata record of an artifact, or ErrNotFound
+	GetMetadata(ctx context.Context, id string) ([]byte, error)
+
+	// List returns every stored artifact
+	List(ctx context.Context) ([]ArtifactInfo, error)
+
+	// Get returns an artifact and its files, or ErrNotFound
+	Get(ctx context.Context, id string) (*Artifact, error)
+
+	// Delete removes an artifact and its metadata, or returns ErrNotFound
+	Delete(ctx context.Context, id string) error
+
+	// Ping checks that the backend is reachable and writable
+	Ping(ctx context.Context) error
+
+	// Name returns the backend name for logs and health reports
+	Name() string
+}
+
+// Namespaces keep saved artifacts apart from quarantined (invalid) generations
+const (
+	NamespaceArtifacts  = "artifacts"
+	NamespaceQuarantine = "quarantine"
+)
+
+var (
+	currentMu  sync.RWMutex
+	current    Storage
+	quarantine Storage
+	tenants    = map[string][2]Storage{} // tenant -> artifacts, quarantine
+)
+
+// Init selects the storage backend from storage.backend (filesystem, s3 or sqlite)
+// and opens both the artifact and the quarantine namespace on it
+func Init() error {
+	backend, err := newFromConfig(NamespaceArtifacts, "")
+	if err != nil {
+		return err
+	}
+	quarantined, err := newFromConfig(NamespaceQuarantine, "")
+	if err != nil {
+		return err
+	}
+
+	currentMu.Lock()
+	current = backend
+	quarantine = quarantined
+	tenants = map[string][2]Storage{}
+	currentMu.Unlock()
+
+	slog.Info("Artifact storage initialized", "backend", backend.Name())
+	return nil
+}
+
+// Current returns the configured backend, defaulting to the local filesystem
+func Current() Storage {
+	currentMu.RLock()
+	backend := current
+	currentMu.RUnlock()
+	if backend != nil {
+		return backend
+	}
+
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	if current == nil {
+		current = NewFilesystemStore(config.Current().Storage.Dir)
+	}
+	return current
+}
+
+// Quarantine returns the namespace for invalid generations, defaulting to the local filesystem
+func Quarantine() Storage {
+	currentMu.RLock()
+	backend := quarantine
+	currentMu.RUnlock()
+	if backend != nil {
+		return backend
+	}
+
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	if quarantine == nil {
+		quarantine = NewFilesystemStore(config.Current().Storage.QuarantineDir)
+	}
+	return quarantine
+}
+
+// ForTenant returns the artifact and quarantine namespaces of a tenant on the configured backend:
+// tenants/<tenant>/ under the artifact directory or S3 prefix, or a separate SQLite database
+func ForTenant(tenant string) (Storage, Storage, error) {
+	currentMu.RLock()
+	stores, ok := tenants[tenant]
+	currentMu.RUnlock()
+	if ok {
+		return stores[0], stores[1], nil
+	}
+
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	if stores, ok := tenants[tenant]; ok {
+		return stores[0], stores[1], nil
+	}
+
+	artifacts, err := newFromConfig(NamespaceArtifacts, tenant)
+	if err != nil {
+		return nil, nil, err
+	}
+	quarantined, err := newFromConfig(NamespaceQuarantine, tenant)
+	if err != nil {
+		return nil, nil, err
+	}
+	tenants[tenant] = [2]Storage{artifacts, quarantined}
+	return artifacts, quarantined, nil
+}
+
+// newFromConfig builds the backend selected by the storage settings for a namespace,
+// scoped to a tenant when tenant is not empty
+func newFromConfig(namespace, tenant string) (Storage, error) {
+	settings := config.Current().Storage
+	quarantined := namespace == NamespaceQuarantine
+
+	switch settings.Backend {
+	case "filesystem":
+		dir := settings.Dir
+		if quarantined {
+			dir = settings.QuarantineDir
+		}
+		if tenant != "" {
+			dir = filepath.Join(dir, "tenants", tenant)
+		}
+		return NewFilesystemStore(dir), nil
+
+	case "s3":
+		// Quarantined objects live under <prefix>quarantine/, which artifact listings skip
+		prefix := settings.S3.Prefix
+		if (quarantined || tenant != "") && prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		if tenant != "" {
+			prefix += "tenants/" + tenant + "/"
+		}
+		if quarantined {
+			prefix += "quarantine/"
+		}
+		return NewS3Store(S3Config{
+			Endpoint:        settings.S3.Endpoint,
+			Bucket:          settings.S3.Bucket,
+			Prefix:          prefix,
+			Region:          settings.S3.Region,
+			AccessKeyID:     settings.S3.AccessKeyID,
+			SecretAccessKey: settings.S3.SecretAccessKey,
+			UseSSL:          settings.S3.UseSSL,
+		})
+
+	case "sqlite":
+		path := settings.SQLite.Path
+		if quarantined {
+			path = settings.SQLite.QuarantinePath
+		}
+		if tenant != "" {
+			path = strings.TrimSuffix(path, ".db") + "-" + tenant + ".db"
+		}
+		return NewSQLiteStore(path)
+
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (expected filesystem, s3 or sqlite)", settings.Backend)
+	}
+}
@@ -0,0 +1,557 @@
+package tenants
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-autopilot/config"
+	"devops-autopilot/logging"
+	"devops-autopilot/ratelimit"
+	"devops-autopilot/utils"
+)
+
+// idPattern matches tenant IDs; they never contain "_" so they cannot clash with artifact IDs
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,39}$`)
+
+// ErrTenantNotFound is returned when a tenant does not exist
+var ErrTenantNotFound error = utils.NewError(utils.CodeNotFound, "tenant not found", nil)
+
+// ValidID reports whether id is a well-formed tenant ID
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// Credentials are provider credentials used instead of the service-wide ones
+type Credentials struct {
+	OpenAIAPIKey string `json:"openaiApiKey,omitempty"`
+	GitHubToken  string `json:"githubToken,omitempty"`
+}
+
+// For returns the credential for an LLM provider ("openai" or "copilot"), or "" when there is none
+func (c Credentials) For(provider string) string {
+	switch provider {
+	case "openai":
+		return c.OpenAIAPIKey
+	case "copilot":
+		return c.GitHubToken
+	default:
+		return ""
+	}
+}
+
+// redactFromLogs scrubs the credentials from all log output
+func (c Credentials) redactFromLogs() {
+	logging.AddSecrets(c.OpenAIAPIKey, c.GitHubToken)
+}
+
+// RateLimit bounds how often a tenant may call an LLM provider; 0 means unlimited
+type RateLimit struct {
+	RequestsPerMinute int `json:"requestsPerMinute"`
+}
+
+// Quota bounds a tenant's LLM usage per calendar month (UTC); 0 means unlimited
+type Quota struct {
+	MonthlyTokens  int     `json:"monthlyTokens"`
+	MonthlyCostUSD float64 `json:"monthlyCostUsd"`
+}
+
+// Tenant is a team sharing the deployment
+type Tenant struct {
+	ID                string      `json:"id"`
+	Name              string      `json:"name"`
+	Credentials       Credentials `json:"credentials"`
+	PromptConventions string      `json:"promptConventions,omitempty"` // appended to every generation prompt
+	Repos             []string    `json:"repos,omitempty"`             // GitHub owner/name repositories whose ChatOps commands act for the tenant
+	RateLimit         RateLimit   `json:"rateLimit"`
+	Quota             Quota       `json:"quota"`
+	CreatedAt         time.Time   `json:"createdAt"`
+	UpdatedAt         time.Time   `json:"updatedAt"`
+}
+
+// Redacted returns a copy safe to return from the API, with credentials masked
+func (t Tenant) Redacted() Tenant {
+	if t.Credentials.OpenAIAPIKey != "" {
+		t.Credentials.OpenAIAPIKey = "********"
+	}
+	if t.Credentials.GitHubToken != "" {
+		t.Credentials.GitHubToken = "********"
+	}
+	return t
+}
+
+// Usage is a tenant's LLM usage in one month
+type Usage struct {
+	Month            string  `json:"month"` // YYYY-MM
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	TotalTokens      int     `json:"totalTokens"`
+	CostUSD          float64 `json:"costUsd"`
+}
+
+// usageSaveDelay batches usage writes: counters changed by generations are saved at most this often
+const usageSaveDelay = 5 * time.Second
+
+// Registry holds tenants and their usage, persisted as JSON files
+type Registry struct {
+	mu        sync.Mutex
+	path      string // "" keeps tenants in memory only
+	usagePath string
+	tenants   map[string]*Tenant
+	usage     map[string]map[string]*Usage // tenant -> month -> usage
+	reserved  map[string]Usage             // tenant -> usage reserved by generations in flight
+	saveTimer *time.Timer                  // pending batched usage write
+	now       func() time.Time
+}
+
+// Open loads a registry from its files; missing files start an empty registry
+func Open(path, usagePath string) (*Registry, error) {
+	r := &Registry{
+		path:      path,
+		usagePath: usagePath,
+		tenants:   map[string]*Tenant{},
+		usage:     map[string]map[string]*Usage{},
+		reserved:  map[string]Usage{},
+		now:       time.Now,
+	}
+
+	var tenants []*Tenant
+	if err := readJSON(path, &tenants); err != nil {
+		return nil, fmt.Errorf("failed to load tenants: %w", err)
+	}
+	for _, tenant := range tenants {
+		if !ValidID(tenant.ID) {
+			return nil, fmt.Errorf("invalid tenant ID %q in %s", tenant.ID, path)
+		}
+		r.tenants[tenant.ID] = tenant
+		tenant.Credentials.redactFromLogs()
+	}
+
+	if err := readJSON(usagePath, &r.usage); err != nil {
+		return nil, fmt.Errorf("failed to load tenant usage: %w", err)
+	}
+	return r, nil
+}
+
+// Empty reports whether no tenants are defined
+func (r *Registry) Empty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.tenants) == 0
+}
+
+// List returns every tenant ordered by ID
+func (r *Registry) List() []Tenant {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tenants := make([]Tenant, 0, len(r.tenants))
+	for _, tenant := range r.tenants {
+		tenants = append(tenants, *tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants
+}
+
+// Get returns a tenant, or ErrTenantNotFound
+func (r *Registry) Get(id string) (*Tenant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tenant, ok := r.tenants[id]
+	if !ok {
+		return nil, ErrTenantNotFound
+	}
+	copied := *tenant
+	return &copied, nil
+}
+
+// ForRepo returns the tenant a GitHub repository is assigned to, or ErrTenantNotFound
+func (r *Registry) ForRepo(repo string) (*Tenant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if owner := r.repoOwner(repo); owner != nil {
+		copied := *owner
+		return &copied, nil
+	}
+	return nil, ErrTenantNotFound
+}
+
+// repoOwner returns the tenant a repository is assigned to, or nil; callers hold r.mu
+func (r *Registry) repoOwner(repo string) *Tenant {
+	for _, tenant := range r.tenants {
+		for _, assigned := range tenant.Repos {
+			if strings.EqualFold(assigned, repo) {
+				return tenant
+			}
+		}
+	}
+	return nil
+}
+
+// checkRepos rejects repositories already assigned to another tenant; callers hold r.mu
+func (r *Registry) checkRepos(tenant Tenant) error {
+	for _, repo := range tenant.Repos {
+		if owner := r.repoOwner(repo); owner != nil && owner.ID != tenant.ID {
+			return utils.NewError(utils.CodeConflict, fmt.Sprintf("repository %q is already assigned to tenant %q", repo, owner.ID), nil)
+		}
+	}
+	return nil
+}
+
+// Create adds a tenant; its ID must be unused
+func (r *Registry) Create(tenant Tenant) (*Tenant, error) {
+	if err := validate(tenant); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tenants[tenant.ID]; exists {
+		return nil, utils.NewError(utils.CodeConflict, fmt.Sprintf("tenant %q already exists", tenant.ID), nil)
+	}
+	if err := r.checkRepos(tenant); err != nil {
+		return nil, err
+	}
+	tenant.CreatedAt = r.now().UTC()
+	tenant.UpdatedAt = tenant.CreatedAt
+	r.tenants[tenant.ID] = &tenant
+	tenant.Credentials.redactFromLogs()
+
+	if err := r.saveTenants(); err != nil {
+		delete(r.tenants, tenant.ID)
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+// Update replaces a tenant's settings. Credentials left empty keep their current values.
+func (r *Registry) Update(tenant Tenant) (*Tenant, error) {
+	if err := validate(tenant); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.tenants[tenant.ID]
+	if !ok {
+		return nil, ErrTenantNotFound
+	}
+	if err := r.checkRepos(tenant); err != nil {
+		return nil, err
+	}
+	if tenant.Credentials.OpenAIAPIKey == "" {
+		tenant.Credentials.OpenAIAPIKey = existing.Credentials.OpenAIAPIKey
+	}
+	if tenant.Credentials.GitHubToken == "" {
+		tenant.Credentials.GitHubToken = existing.Credentials.GitHubToken
+	}
+	tenant.CreatedAt = existing.CreatedAt
+	tenant.UpdatedAt = r.now().UTC()
+	r.tenants[tenant.ID] = &tenant
+	tenant.Credentials.redactFromLogs()
+
+	if err := r.saveTenants(); err != nil {
+		r.tenants[tenant.ID] = existing
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+// Delete removes a tenant and its usage counters; its artifacts are kept
+func (r *Registry) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.tenants[id]
+	if !ok {
+		return ErrTenantNotFound
+	}
+	delete(r.tenants, id)
+	if err := r.saveTenants(); err != nil {
+		r.tenants[id] = existing
+		return err
+	}
+
+	delete(r.usage, id)
+	if err := r.saveUsage(); err != nil {
+		slog.Warn("Failed to remove tenant usage", "tenant", id, "error", err)
+	}
+	return nil
+}
+
+// Usage returns a tenant's usage in the current month
+func (r *Registry) Usage(id string) Usage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.currentUsage(id)
+}
+
+// currentUsage returns a copy of the current month's usage; callers hold r.mu
+func (r *Registry) currentUsage(id string) Usage {
+	month := r.now().UTC().Format("2006-01")
+	if usage, ok := r.usage[id][month]; ok {
+		return *usage
+	}
+	return Usage{Month: month}
+}
+
+// Reservation holds a generation's estimated usage against its tenant's quota until it is settled
+type Reservation struct {
+	tenant string
+	tokens int
+	cost   float64
+}
+
+// CheckGeneration enforces a tenant's rate limit and monthly quota before an LLM call and reserves
+// the call's estimated usage, so concurrent calls cannot together overshoot the quota. The
+// reservation must be passed to Settle or Release. A nil tenant is never limited.
+func (r *Registry) CheckGeneration(tenant *Tenant, model string, estimate utils.TokenUsage) (*Reservation, error) {
+	if tenant == nil {
+		return nil, nil
+	}
+
+	reservation := &Reservation{tenant: tenant.ID, tokens: estimate.TotalTokens, cost: utils.EstimateCost(model, estimate)}
+
+	r.mu.Lock()
+	usage := r.currentUsage(tenant.ID)
+	reserved := r.reserved[tenant.ID]
+	quota := tenant.Quota
+	if quota.MonthlyTokens > 0 && usage.TotalTokens+reserved.TotalTokens+reservation.tokens > quota.MonthlyTokens {
+		r.mu.Unlock()
+		return nil, utils.NewError(utils.CodeQuotaExceeded, fmt.Sprintf("tenant %q has used its monthly token quota", tenant.ID),
+			fmt.Errorf("%d of %d tokens used, %d reserved and %d estimated in %s", usage.TotalTokens, quota.MonthlyTokens, reserved.TotalTokens, reservation.tokens, usage.Month))
+	}
+	if quota.MonthlyCostUSD > 0 && usage.CostUSD+reserved.CostUSD+reservation.cost > quota.MonthlyCostUSD {
+		r.mu.Unlock()
+		return nil, utils.NewError(utils.CodeQuotaExceeded, fmt.Sprintf("tenant %q has used its monthly cost quota", tenant.ID),
+			fmt.Errorf("$%.2f of $%.2f used, $%.2f reserved and $%.2f estimated in %s", usage.CostUSD, quota.MonthlyCostUSD, reserved.CostUSD, reservation.cost, usage.Month))
+	}
+	reserved.Requests++
+	reserved.TotalTokens += reservation.tokens
+	reserved.CostUSD += reservation.cost
+	r.reserved[tenant.ID] = reserved
+	r.mu.Unlock()
+
+	if rpm := tenant.RateLimit.RequestsPerMinute; rpm > 0 {
+		result, err := ratelimit.Default().Take(context.Background(), "tenant:"+tenant.ID, ratelimit.PerMinute(rpm))
+		if err != nil {
+			r.Release(reservation)
+			return nil, utils.NewRetryableError(utils.CodeUnavailable, "rate limiter unavailable", err)
+		}
+		if !result.Allowed {
+			r.Release(reservation)
+			return nil, utils.NewRetryableError(utils.CodeRateLimited, fmt.Sprintf("tenant %q exceeded %d generations per minute", tenant.ID, rpm),
+				fmt.Errorf("retry after %s", result.RetryAfter.Round(time.Second)))
+		}
+	}
+	return reservation, nil
+}
+
+// Release drops a reservation whose LLM call was not made or failed
+func (r *Registry) Release(reservation *Reservation) {
+	if reservation == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.release(reservation)
+}
+
+// release drops a reservation; callers hold r.mu
+func (r *Registry) release(reservation *Reservation) {
+	reserved := r.reserved[reservation.tenant]
+	reserved.Requests--
+	reserved.TotalTokens -= reservation.tokens
+	reserved.CostUSD -= reservation.cost
+	if reserved.Requests <= 0 {
+		delete(r.reserved, reservation.tenant)
+		return
+	}
+	r.reserved[reservation.tenant] = reserved
+}
+
+// Settle replaces a reservation with the tokens and estimated cost the LLM call actually used.
+// Counters are written to disk in batches, at most every usageSaveDelay.
+func (r *Registry) Settle(reservation *Reservation, model string, tokens utils.TokenUsage) {
+	if reservation == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.release(reservation)
+
+	month := r.now().UTC().Format("2006-01")
+	if r.usage[reservation.tenant] == nil {
+		r.usage[reservation.tenant] = map[string]*Usage{}
+	}
+	usage, ok := r.usage[reservation.tenant][month]
+	if !ok {
+		usage = &Usage{Month: month}
+		r.usage[reservation.tenant][month] = usage
+	}
+	usage.Requests++
+	usage.PromptTokens += tokens.PromptTokens
+	usage.CompletionTokens += tokens.CompletionTokens
+	usage.TotalTokens += tokens.TotalTokens
+	usage.CostUSD += utils.EstimateCost(model, tokens)
+
+	if r.saveTimer == nil {
+		r.saveTimer = time.AfterFunc(usageSaveDelay, func() {
+			if err := r.Flush(); err != nil {
+				slog.Warn("Failed to save tenant usage", "error", err)
+			}
+		})
+	}
+}
+
+// Flush writes pending usage counters now; call it before exiting
+func (r *Registry) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.saveTimer == nil {
+		return nil
+	}
+	r.saveTimer.Stop()
+	r.saveTimer = nil
+	return r.saveUsage()
+}
+
+// validate checks a tenant definition
+func validate(tenant Tenant) error {
+	switch {
+	case !ValidID(tenant.ID):
+		return utils.NewError(utils.CodeInvalidRequest, "id must be 1-40 lowercase letters, digits or dashes", nil)
+	case tenant.RateLimit.RequestsPerMinute < 0:
+		return utils.NewError(utils.CodeInvalidRequest, "rateLimit.requestsPerMinute cannot be negative", nil)
+	case tenant.Quota.MonthlyTokens < 0 || tenant.Quota.MonthlyCostUSD < 0:
+		return utils.NewError(utils.CodeInvalidRequest, "quota values cannot be negative", nil)
+	}
+	for _, repo := range tenant.Repos {
+		if !utils.ValidGitHubRepo(repo) {
+			return utils.NewError(utils.CodeInvalidRequest, fmt.Sprintf("repos: %q is not an owner/name repository", repo), nil)
+		}
+	}
+	return nil
+}
+
+// saveTenants writes the tenant list; callers hold r.mu
+func (r *Registry) saveTenants() error {
+	tenants := make([]*Tenant, 0, len(r.tenants))
+	for _, tenant := range r.tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	if err := writeJSON(r.path, tenants); err != nil {
+		return utils.NewError(utils.CodeStorageError, "failed to save tenants", err)
+	}
+	return nil
+}
+
+// saveUsage writes usage counters; callers hold r.mu
+func (r *Registry) saveUsage() error {
+	return writeJSON(r.usagePath, r.usage)
+}
+
+// readJSON decodes a file into out; a missing file or empty path leaves out unchanged
+func readJSON(path string, out interface{}) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// writeJSON replaces a file atomically; an empty path skips persistence.
+// Files may hold credentials, so they are only readable by the owner.
+func writeJSON(path string, value interface{}) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+var (
+	defaultMu       sync.RWMutex
+	defaultRegistry *Registry
+)
+
+// Init loads the registry from tenants.file and tenants.usage_file
+func Init() error {
+	settings := config.Current().Tenants
+	path, usagePath := settings.File, settings.UsageFile
+
+	registry, err := Open(path, usagePath)
+	if err != nil {
+		return err
+	}
+
+	defaultMu.Lock()
+	defaultRegistry = registry
+	defaultMu.Unlock()
+
+	if count := len(registry.List()); count > 0 {
+		slog.Info("Tenants loaded", "count", count, "path", path)
+	}
+	return nil
+}
+
+// Default returns the registry loaded by Init, or an empty in-memory registry
+func Default() *Registry {
+	defaultMu.RLock()
+	registry := defaultRegistry
+	defaultMu.RUnlock()
+	if registry != nil {
+		return registry
+	}
+
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultRegistry == nil {
+		defaultRegistry, _ = Open("", "")
+	}
+	return defaultRegistry
+}
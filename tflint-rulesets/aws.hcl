@@ -0,0 +1,14 @@
+# Example tflint ruleset, selected with "lintRuleset": "aws".
+# The plugin binary must already be present in TFLINT_PLUGIN_DIR;
+# the service never downloads plugins at request time.
+
+plugin "terraform" {
+  enabled = true
+  preset  = "recommended"
+}
+
+plugin "aws" {
+  enabled = true
+  version = "0.30.0"
+  source  = "github.com/terraform-linters/tflint-ruleset-aws"
+}
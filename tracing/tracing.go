@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"devops-autopilot/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifies this service in traces unless OTEL_SERVICE_NAME overrides it
+const ServiceName = "devops-autopilot"
+
+// tracerName is the instrumentation scope of spans created by Start
+const tracerName = "devops-autopilot"
+
+var provider *sdktrace.TracerProvider
+
+// Init sets up the exporter named by tracing.exporter (OTEL_TRACES_EXPORTER): "otlp" (configured
+// with the standard OTEL_EXPORTER_OTLP_* variables), "console" to print spans to stdout, or "none"
+// (default). Spans are no-ops until Init enables an exporter.
+func Init() error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	name := config.Current().Tracing.Exporter
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch name {
+	case "none":
+		return nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background())
+	case "console":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return fmt.Errorf("unknown tracing exporter %q (expected otlp, console or none)", name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(ServiceName)))
+	if err != nil {
+		return fmt.Errorf("failed to build trace resource: %w", err)
+	}
+	// Variables such as OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence
+	if fromEnv, err := resource.New(context.Background(), resource.WithFromEnv()); err == nil {
+		if merged, err := resource.Merge(res, fromEnv); err == nil {
+			res = merged
+		}
+	}
+
+	provider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	slog.Info("Tracing enabled", "exporter", name)
+	return nil
+}
+
+// Shutdown flushes buffered spans to the exporter
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
+
+// Start begins a span as a child of any span in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on the span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,255 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// amiIDPattern matches a literal AMI ID
+var amiIDPattern = regexp.MustCompile(`^ami-[0-9a-f]{8,17}$`)
+
+// gravitonInstancePattern matches ARM-based (Graviton) instance types such as t4g.micro or m7gd.large
+var gravitonInstancePattern = regexp.MustCompile(`^[a-z]+\d+g[a-z]*\.`)
+
+// amiAttributes lists the resource types whose AMI attribute is rewritten
+var amiAttributes = map[string]string{
+	"aws_instance":        "ami",
+	"aws_launch_template": "image_id",
+}
+
+// amiImage describes an image family that can be looked up with an aws_ami data source
+type amiImage struct {
+	slug        string
+	description string
+	owner       string
+	namePattern string // %s is replaced with the architecture
+	archNames   map[string]string
+	keywords    *regexp.Regexp
+}
+
+// amiImages are tried in order, so more specific versions come before generic names
+var amiImages = []amiImage{
+	{
+		slug: "ubuntu_24_04", description: "Ubuntu 24.04 LTS", owner: "099720109477",
+		namePattern: "ubuntu/images/hvm-ssd-gp3/ubuntu-noble-24.04-%s-server-*",
+		archNames:   map[string]string{"x86_64": "amd64", "arm64": "arm64"},
+		keywords:    regexp.MustCompile(`(?i)ubuntu[\s-]*24\.04|noble`),
+	},
+	{
+		slug: "ubuntu_22_04", description: "Ubuntu 22.04 LTS", owner: "099720109477",
+		namePattern: "ubuntu/images/hvm-ssd/ubuntu-jammy-22.04-%s-server-*",
+		archNames:   map[string]string{"x86_64": "amd64", "arm64": "arm64"},
+		keywords:    regexp.MustCompile(`(?i)ubuntu[\s-]*22\.04|jammy`),
+	},
+	{
+		slug: "ubuntu_20_04", description: "Ubuntu 20.04 LTS", owner: "099720109477",
+		namePattern: "ubuntu/images/hvm-ssd/ubuntu-focal-20.04-%s-server-*",
+		archNames:   map[string]string{"x86_64": "amd64", "arm64": "arm64"},
+		keywords:    regexp.MustCompile(`(?i)ubuntu[\s-]*20\.04|focal`),
+	},
+	{
+		slug: "ubuntu_24_04", description: "Ubuntu 24.04 LTS", owner: "099720109477",
+		namePattern: "ubuntu/images/hvm-ssd-gp3/ubuntu-noble-24.04-%s-server-*",
+		archNames:   map[string]string{"x86_64": "amd64", "arm64": "arm64"},
+		keywords:    regexp.MustCompile(`(?i)ubuntu`),
+	},
+	{
+		slug: "amazon_linux_2", description: "Amazon Linux 2", owner: "amazon",
+		namePattern: "amzn2-ami-hvm-*-%s-gp2",
+		archNames:   map[string]string{"x86_64": "x86_64", "arm64": "arm64"},
+		keywords:    regexp.MustCompile(`(?i)amazon[\s-]*linux[\s-]*2(\s|$|[^0-9])|amzn2`),
+	},
+	{
+		slug: "debian_12", description: "Debian 12", owner: "136693071363",
+		namePattern: "debian-12-%s-*",
+		archNames:   map[string]string{"x86_64": "amd64", "arm64": "arm64"},
+		keywords:    regexp.MustCompile(`(?i)debian|bookworm`),
+	},
+	{
+		slug: "rhel_9", description: "Red Hat Enterprise Linux 9", owner: "309956199498",
+		namePattern: "RHEL-9.*_HVM-*-%s-*",
+		archNames:   map[string]string{"x86_64": "x86_64", "arm64": "arm64"},
+		keywords:    regexp.MustCompile(`(?i)rhel|red\s*hat`),
+	},
+	{
+		slug: "windows_2022", description: "Windows Server 2022", owner: "amazon",
+		namePattern: "Windows_Server-2022-English-Full-Base-*",
+		archNames:   map[string]string{"x86_64": "x86_64"},
+		keywords:    regexp.MustCompile(`(?i)windows`),
+	},
+	{
+		slug: "amazon_linux_2023", description: "Amazon Linux 2023", owner: "amazon",
+		namePattern: "al2023-ami-2023.*-%s",
+		archNames:   map[string]string{"x86_64": "x86_64", "arm64": "arm64"},
+		keywords:    regexp.MustCompile(`(?i)amazon[\s-]*linux|al2023`),
+	},
+}
+
+// defaultAMIImage is used when neither the comment nor the specs name an image
+var defaultAMIImage = amiImages[len(amiImages)-1]
+
+// AMIReplacement describes a hard-coded AMI ID that was rewritten into a data source lookup
+type AMIReplacement struct {
+	Resource     string `json:"resource"`
+	Attribute    string `json:"attribute"`
+	OriginalAMI  string `json:"originalAmi"`
+	DataSource   string `json:"dataSource"`
+	Image        string `json:"image"`
+	InferredFrom string `json:"inferredFrom"` // comment, specs or default
+}
+
+// ReplaceHardcodedAMIs rewrites literal AMI IDs on aws_instance and aws_launch_template into aws_ami data sources.
+// The image is inferred from the attribute's comment first, then from hints such as the request specs.
+func ReplaceHardcodedAMIs(terraformCode, hints string) (string, []AMIReplacement, error) {
+	// Appended blocks need the last existing block to end with a newline
+	src := strings.TrimRight(terraformCode, "\n") + "\n"
+	file, diags := hclwrite.ParseConfig([]byte(src), "main.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return "", nil, fmt.Errorf("failed to parse terraform code: %s", diags.Error())
+	}
+
+	body := file.Body()
+	existing := map[string]bool{}
+	for _, block := range body.Blocks() {
+		if block.Type() == "data" && len(block.Labels()) == 2 && block.Labels()[0] == "aws_ami" {
+			existing[block.Labels()[1]] = true
+		}
+	}
+
+	var replacements []AMIReplacement
+	dataSources := map[string]string{} // image slug + arch -> data source name
+
+	for _, block := range body.Blocks() {
+		labels := block.Labels()
+		if block.Type() != "resource" || len(labels) != 2 {
+			continue
+		}
+		attrName, ok := amiAttributes[labels[0]]
+		if !ok {
+			continue
+		}
+		attr := block.Body().GetAttribute(attrName)
+		if attr == nil {
+			continue
+		}
+
+		amiID, comment := literalWithComment(attr)
+		if !amiIDPattern.MatchString(amiID) {
+			continue
+		}
+
+		image, inferredFrom := inferAMIImage(comment, hints)
+		arch := "x86_64"
+		if instanceType := literalString(block.Body().GetAttribute("instance_type")); gravitonInstancePattern.MatchString(instanceType) {
+			if _, ok := image.archNames["arm64"]; ok {
+				arch = "arm64"
+			}
+		}
+
+		key := image.slug + "_" + arch
+		name, ok := dataSources[key]
+		if !ok {
+			baseName := image.slug
+			if arch != "x86_64" {
+				baseName += "_" + arch
+			}
+			name = baseName
+			for i := 2; existing[name]; i++ {
+				name = fmt.Sprintf("%s_%d", baseName, i)
+			}
+			existing[name] = true
+			dataSources[key] = name
+			appendAMIDataSource(body, name, image, arch)
+		}
+
+		block.Body().SetAttributeTraversal(attrName, hcl.Traversal{
+			hcl.TraverseRoot{Name: "data"},
+			hcl.TraverseAttr{Name: "aws_ami"},
+			hcl.TraverseAttr{Name: name},
+			hcl.TraverseAttr{Name: "id"},
+		})
+
+		replacements = append(replacements, AMIReplacement{
+			Resource:     labels[0] + "." + labels[1],
+			Attribute:    attrName,
+			OriginalAMI:  amiID,
+			DataSource:   "data.aws_ami." + name,
+			Image:        fmt.Sprintf("%s (%s)", image.description, arch),
+			InferredFrom: inferredFrom,
+		})
+	}
+
+	if len(replacements) == 0 {
+		return terraformCode, nil, nil
+	}
+
+	result := string(hclwrite.Format(file.Bytes()))
+	if !strings.HasSuffix(terraformCode, "\n") {
+		result = strings.TrimRight(result, "\n")
+	}
+	return result, replacements, nil
+}
+
+// inferAMIImage picks an image family from the attribute comment, then the hints, then the default
+func inferAMIImage(comment, hints string) (amiImage, string) {
+	for _, source := range []struct{ text, name string }{{comment, "comment"}, {hints, "specs"}} {
+		for _, image := range amiImages {
+			if source.text != "" && image.keywords.MatchString(source.text) {
+				return image, source.name
+			}
+		}
+	}
+	return defaultAMIImage, "default"
+}
+
+// appendAMIDataSource appends an aws_ami data source with owner and name filters
+func appendAMIDataSource(body *hclwrite.Body, name string, image amiImage, arch string) {
+	namePattern := image.namePattern
+	if strings.Contains(namePattern, "%s") {
+		namePattern = fmt.Sprintf(namePattern, image.archNames[arch])
+	}
+
+	body.AppendNewline()
+	data := body.AppendNewBlock("data", []string{"aws_ami", name}).Body()
+	data.SetAttributeValue("most_recent", cty.True)
+	data.SetAttributeValue("owners", cty.ListVal([]cty.Value{cty.StringVal(image.owner)}))
+
+	data.AppendNewline()
+	nameFilter := data.AppendNewBlock("filter", nil).Body()
+	nameFilter.SetAttributeValue("name", cty.StringVal("name"))
+	nameFilter.SetAttributeValue("values", cty.ListVal([]cty.Value{cty.StringVal(namePattern)}))
+
+	data.AppendNewline()
+	archFilter := data.AppendNewBlock("filter", nil).Body()
+	archFilter.SetAttributeValue("name", cty.StringVal("architecture"))
+	archFilter.SetAttributeValue("values", cty.ListVal([]cty.Value{cty.StringVal(arch)}))
+}
+
+// literalWithComment returns an attribute's string literal value and any comment on the same line
+func literalWithComment(attr *hclwrite.Attribute) (string, string) {
+	var comment strings.Builder
+	for _, token := range attr.BuildTokens(nil) {
+		if token.Type == hclsyntax.TokenComment {
+			comment.Write(token.Bytes)
+		}
+	}
+	return literalString(attr), strings.TrimSpace(comment.String())
+}
+
+// literalString returns the value of an attribute that is a plain string literal, or ""
+func literalString(attr *hclwrite.Attribute) string {
+	if attr == nil {
+		return ""
+	}
+	tokens := attr.Expr().BuildTokens(nil)
+	if len(tokens) != 3 || tokens[0].Type != hclsyntax.TokenOQuote || tokens[1].Type != hclsyntax.TokenQuotedLit || tokens[2].Type != hclsyntax.TokenCQuote {
+		return ""
+	}
+	return string(tokens[1].Bytes)
+}
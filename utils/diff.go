@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContextLines is the number of unchanged lines shown around each change
+const diffContextLines = 3
+
+// maxDiffCells caps the LCS table at about 32 MB. Above it the changed region is diffed as a
+// single replacement, which is still a correct diff but not a minimal one.
+const maxDiffCells = 4_000_000
+
+// diffOp is a single line-level edit produced by diffLines
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// UnifiedDiff returns a unified diff between two texts, or "" if they are equal
+func UnifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+
+	ops := diffLines(splitLines(oldText), splitLines(newText))
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", oldName, newName))
+
+	// Group edits into hunks with surrounding context
+	i := 0
+	for i < len(ops) {
+		// Skip to the next change
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i >= len(ops) {
+			break
+		}
+
+		start := i - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+
+		// Extend the hunk until we see more than 2*context unchanged lines
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContextLines {
+				end += diffContextLines
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+			end = run
+		}
+
+		writeHunk(&sb, ops, start, end)
+		i = end
+	}
+
+	return sb.String()
+}
+
+// writeHunk writes ops[start:end] as a single unified diff hunk
+func writeHunk(sb *strings.Builder, ops []diffOp, start, end int) {
+	oldLine, newLine := 1, 1
+	for _, op := range ops[:start] {
+		if op.kind != '+' {
+			oldLine++
+		}
+		if op.kind != '-' {
+			newLine++
+		}
+	}
+
+	oldCount, newCount := 0, 0
+	for _, op := range ops[start:end] {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+
+	// Unified diff convention: an empty range starts at the line before it
+	if oldCount == 0 {
+		oldLine--
+	}
+	if newCount == 0 {
+		newLine--
+	}
+
+	sb.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount))
+	for _, op := range ops[start:end] {
+		sb.WriteByte(op.kind)
+		sb.WriteString(op.text)
+		sb.WriteByte('\n')
+	}
+}
+
+// diffLines computes a line-level edit script. Unchanged leading and trailing lines are matched
+// first; the lines between them are diffed with a longest common subsequence table when it fits
+// within maxDiffCells.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b)-prefix-suffix)
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA)*len(midB) > maxDiffCells {
+		for _, line := range midA {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range midB {
+			ops = append(ops, diffOp{'+', line})
+		}
+	} else {
+		ops = append(ops, lcsDiff(midA, midB)...)
+	}
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// lcsDiff computes a minimal edit script using a longest common subsequence table
+func lcsDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, n+m)
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+
+	return ops
+}
+
+// splitLines splits text into lines without a trailing empty element
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numberedLines returns "<prefix>1\n<prefix>2\n..." with n lines
+func numberedLines(prefix string, n int) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&sb, "%s%d\n", prefix, i)
+	}
+	return sb.String()
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{
+			name: "equal",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name: "changed line",
+			old:  "a\nb\nc\n",
+			new:  "a\nx\nc\n",
+			want: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			name: "added to empty",
+			old:  "",
+			new:  "a\n",
+			want: "--- old\n+++ new\n@@ -0,0 +1,1 @@\n+a\n",
+		},
+		{
+			name: "deleted everything",
+			old:  "a\nb\n",
+			new:  "",
+			want: "--- old\n+++ new\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "inserted line",
+			old:  "a\nb\nc\nd\n",
+			new:  "a\nb\nx\nc\nd\n",
+			want: "--- old\n+++ new\n@@ -1,4 +1,5 @@\n a\n b\n+x\n c\n d\n",
+		},
+		{
+			name: "separate hunks",
+			old:  numberedLines("l", 20),
+			new:  strings.Replace(strings.Replace(numberedLines("l", 20), "l2\n", "x\n", 1), "l18\n", "y\n", 1),
+			want: "--- old\n+++ new\n" +
+				"@@ -1,5 +1,5 @@\n l1\n-l2\n+x\n l3\n l4\n l5\n" +
+				"@@ -15,6 +15,6 @@\n l15\n l16\n l17\n-l18\n+y\n l19\n l20\n",
+		},
+		{
+			name: "close changes share a hunk",
+			old:  numberedLines("l", 8),
+			new:  strings.Replace(strings.Replace(numberedLines("l", 8), "l2\n", "x\n", 1), "l7\n", "y\n", 1),
+			want: "--- old\n+++ new\n@@ -1,8 +1,8 @@\n l1\n-l2\n+x\n l3\n l4\n l5\n l6\n-l7\n+y\n l8\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnifiedDiff("old", "new", tt.old, tt.new); got != tt.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiffLargeReplacement(t *testing.T) {
+	// 2100 x 2100 lines exceeds maxDiffCells, so the changed region becomes one replacement
+	old := "head\n" + numberedLines("a", 2100) + "tail\n"
+	new := "head\n" + numberedLines("b", 2100) + "tail\n"
+
+	got := UnifiedDiff("old", "new", old, new)
+	if !strings.Contains(got, "@@ -1,2102 +1,2102 @@\n head\n-a1\n") {
+		t.Fatalf("unexpected hunk header or start:\n%.200s", got)
+	}
+	if removed, added := strings.Count(got, "\n-a"), strings.Count(got, "\n+b"); removed != 2100 || added != 2100 {
+		t.Errorf("got %d removed and %d added lines, want 2100 each", removed, added)
+	}
+	if !strings.HasSuffix(got, "+b2100\n tail\n") {
+		t.Errorf("replacement should end with the new lines and the shared tail")
+	}
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrorCode is a machine-readable error category returned to API clients
+type ErrorCode string
+
+// Error codes; models.ErrorStatus maps each code to an HTTP status
+const (
+	CodeInvalidRequest        ErrorCode = "invalid_request"
+	CodeUnauthorized          ErrorCode = "unauthorized"
+	CodeForbidden             ErrorCode = "forbidden"
+	CodeNotFound              ErrorCode = "not_found"
+	CodeConflict              ErrorCode = "conflict"
+	CodeUnprocessable         ErrorCode = "unprocessable"
+	CodeRateLimited           ErrorCode = "rate_limited"
+	CodeQuotaExceeded         ErrorCode = "quota_exceeded"
+	CodeProviderNotConfigured ErrorCode = "provider_not_configured"
+	CodeProviderDisabled      ErrorCode = "provider_disabled"
+	CodeProviderRateLimited   ErrorCode = "provider_rate_limited"
+	CodeProviderQuotaExceeded ErrorCode = "provider_quota_exceeded"
+	CodeProviderAuthFailed    ErrorCode = "provider_auth_failed"
+	CodeProviderRejected      ErrorCode = "provider_rejected"
+	CodeProviderError         ErrorCode = "provider_error"
+	CodeProviderTimeout       ErrorCode = "provider_timeout"
+	CodeEmptyOutput           ErrorCode = "empty_output"
+	CodeTerraformFailed       ErrorCode = "terraform_failed"
+	CodeStorageError          ErrorCode = "storage_error"
+	CodeGitError              ErrorCode = "git_error"
+	CodeGitHubError           ErrorCode = "github_error"
+	CodeUnavailable           ErrorCode = "unavailable"
+	CodeInternal              ErrorCode = "internal_error"
+)
+
+// Error is a typed error carrying a code and whether the same request may succeed if retried
+type Error struct {
+	Code      ErrorCode
+	Message   string
+	Retryable bool
+	Err       error // underlying cause, reported as details
+}
+
+// Error returns the message followed by the underlying cause
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError creates a typed error that is not retryable
+func NewError(code ErrorCode, message string, err error) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+// NewRetryableError creates a typed error for a transient failure
+func NewRetryableError(code ErrorCode, message string, err error) *Error {
+	return &Error{Code: code, Message: message, Retryable: true, Err: err}
+}
+
+// AsError finds the first typed error in err's chain
+func AsError(err error) (*Error, bool) {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed, true
+	}
+	return nil, false
+}
+
+// isTimeout reports whether err is a deadline or network timeout
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// providerStatusError classifies an HTTP error status returned by an LLM provider
+func providerStatusError(provider string, status int, quotaExceeded bool, err error) *Error {
+	switch {
+	case status == http.StatusTooManyRequests && quotaExceeded:
+		return NewError(CodeProviderQuotaExceeded, provider+" quota exceeded", err)
+	case status == http.StatusTooManyRequests:
+		return NewRetryableError(CodeProviderRateLimited, provider+" rate limit reached", err)
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return NewError(CodeProviderAuthFailed, provider+" rejected the credentials", err)
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return NewRetryableError(CodeProviderTimeout, provider+" timed out", err)
+	case status >= 500:
+		return NewRetryableError(CodeProviderError, provider+" returned a server error", err)
+	default:
+		return NewError(CodeProviderRejected, provider+" rejected the request", err)
+	}
+}
+
+// classifyOpenAIError maps an OpenAI client error to a typed error
+func classifyOpenAIError(err error) *Error {
+	if isTimeout(err) {
+		return NewRetryableError(CodeProviderTimeout, "OpenAI timed out", err)
+	}
+
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		code, _ := apiErr.Code.(string)
+		quota := code == "insufficient_quota" || apiErr.Type == "insufficient_quota"
+		return providerStatusError("OpenAI", apiErr.HTTPStatusCode, quota, err)
+	}
+
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return providerStatusError("OpenAI", reqErr.HTTPStatusCode, false, err)
+	}
+
+	return NewRetryableError(CodeProviderError, "failed to call OpenAI", err)
+}
+
+// classifyGitHubModelsError maps a GitHub Models API error status to a typed error
+func classifyGitHubModelsError(status int, body string) *Error {
+	quota := strings.Contains(strings.ToLower(body), "quota")
+	return providerStatusError("GitHub Models", status, quota,
+		fmt.Errorf("status %d: %s", status, strings.TrimSpace(body)))
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+// TerraformFormatResult holds the result of canonical terraform formatting
+type TerraformFormatResult struct {
+	IsFormatted   bool   `json:"isFormatted"` // input was already in canonical format
+	FormattedCode string `json:"formattedCode"`
+	Diff          string `json:"diff,omitempty"` // unified diff from input to formatted code
+	ExecTime      int64  `json:"execTime"`       // milliseconds
+}
+
+// FormatTerraformCode formats terraform code in-process using the same rules as terraform fmt
+func FormatTerraformCode(terraformCode string) (*TerraformFormatResult, error) {
+	startTime := time.Now()
+
+	if strings.TrimSpace(terraformCode) == "" {
+		return nil, fmt.Errorf("terraform code cannot be empty")
+	}
+
+	// Refuse to format code that does not parse, the formatter would only shuffle broken tokens
+	_, diags := hclwrite.ParseConfig([]byte(terraformCode), "main.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse terraform code: %s", diags.Error())
+	}
+
+	formatted := string(hclwrite.Format([]byte(terraformCode)))
+	isFormatted := formatted == terraformCode
+
+	return &TerraformFormatResult{
+		IsFormatted:   isFormatted,
+		FormattedCode: formatted,
+		Diff:          UnifiedDiff("main.tf", "main.tf (formatted)", terraformCode, formatted),
+		ExecTime:      time.Since(startTime).Milliseconds(),
+	}, nil
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"devops-autopilot/config"
+	"devops-autopilot/metrics"
+	"devops-autopilot/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PromptTemplateVersion identifies the built-in prompt templates used for generation.
+// Bump it whenever openAIPromptTemplate or copilotPromptTemplate changes.
+const PromptTemplateVersion = "3"
+
+// openAIPromptTemplate is the built-in OpenAI prompt, overridden by prompts.openai
+const openAIPromptTemplate = `
+You are a Terraform expert. Generate Terraform code to provision the following:
+
+Resource: {{.Resource}}
+Specs: {{.Specs}}
+
+Only output valid Terraform code inside one block. Do not explain anything.
+`
+
+// copilotPromptTemplate is the built-in GitHub Models prompt, overridden by prompts.copilot
+const copilotPromptTemplate = `You are a Terraform expert. Generate Terraform code to provision the following:
+
+Resource: {{.Resource}}
+Specs: {{.Specs}}
+
+Only output valid Terraform code inside one block. Do not explain anything.
+The code should be production-ready and follow best practices.`
+
+// textDigest identifies a prompt or model output in logs without logging the text, which may
+// contain user data or secrets
+func textDigest(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:8])
+}
+
+// buildPrompt renders the configured template, or the built-in one, and appends conventions and
+// schema excerpts. It returns the prompt and the template version recorded in provenance. The
+// template and its version come from the same prompts snapshot, so a reload cannot pair them wrongly.
+func buildPrompt(prompts config.PromptsConfig, custom, builtin, resource, specs string, opts GenerationOptions) (prompt, version string, err error) {
+	text, version := builtin, PromptTemplateVersion
+	if custom != "" {
+		text, version = custom, prompts.Version
+		if version == "" {
+			sum := sha256.Sum256([]byte(custom))
+			version = "custom-" + hex.EncodeToString(sum[:4])
+		}
+	}
+
+	tmpl, err := template.New("prompt").Parse(text)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid prompt template: %w", err)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, struct{ Resource, Specs string }{resource, specs}); err != nil {
+		return "", "", fmt.Errorf("failed to render prompt template: %w", err)
+	}
+	return sb.String() + conventionsPromptSection(opts.Conventions) + schemaPromptSection(opts.SchemaContext), version, nil
+}
+
+// TokenUsage holds token counts reported by an LLM provider
+type TokenUsage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	TotalTokens      int `json:"totalTokens"`
+}
+
+// GenerationOutput holds raw model output together with provenance details
+type GenerationOutput struct {
+	Content       string     `json:"-"`
+	Model         string     `json:"model"`
+	Usage         TokenUsage `json:"usage"`
+	PromptVersion string     `json:"promptVersion"`
+}
+
+// observeGeneration records a provider call's latency, token usage and error code
+func observeGeneration(provider, model string, start time.Time, out *GenerationOutput, err error) {
+	var usage TokenUsage
+	if out != nil {
+		usage = out.Usage
+	}
+	code := ""
+	if err != nil {
+		code = string(CodeInternal)
+		if typed, ok := AsError(err); ok {
+			code = string(typed.Code)
+		}
+	}
+	metrics.ObserveLLMCall(provider, model, time.Since(start), usage.PromptTokens, usage.CompletionTokens, code)
+}
+
+// startProviderSpan starts the span covering one provider HTTP call
+func startProviderSpan(ctx context.Context, provider, model string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "llm."+provider,
+		attribute.String("llm.provider", provider), attribute.String("llm.model", model))
+}
+
+// endProviderSpan records the model and token usage reported by the provider and ends the span
+func endProviderSpan(span trace.Span, out *GenerationOutput, err error) {
+	if out != nil {
+		span.SetAttributes(
+			attribute.String("llm.response.model", out.Model),
+			attribute.Int("llm.tokens.prompt", out.Usage.PromptTokens),
+			attribute.Int("llm.tokens.completion", out.Usage.CompletionTokens),
+			attribute.Int("llm.tokens.total", out.Usage.TotalTokens),
+		)
+	}
+	tracing.End(span, err)
+}
+
+// GenerationOptions carries grounding and per-tenant settings for a generation call
+type GenerationOptions struct {
+	SchemaContext string // provider schema excerpts for grounding
+	Conventions   string // house conventions appended to the prompt (naming, tagging, ...)
+	APIKey        string // provider credential overriding the one from the environment
+}
+
+// conventionsPromptSection wraps house conventions into a prompt section, or returns "" when there are none
+func conventionsPromptSection(conventions string) string {
+	if strings.TrimSpace(conventions) == "" {
+		return ""
+	}
+	return fmt.Sprintf(`
+Follow these conventions:
+
+%s
+`, strings.TrimSpace(conventions))
+}
+
+// modelPrices are USD per 1K prompt and completion tokens, matched by model name prefix (most specific first)
+var modelPrices = []struct {
+	prefix             string
+	prompt, completion float64
+}{
+	{"gpt-4o-mini", 0.00015, 0.0006},
+	{"gpt-4o", 0.0025, 0.01},
+	{"gpt-4-turbo", 0.01, 0.03},
+	{"gpt-4", 0.03, 0.06},
+	{"gpt-3.5-turbo", 0.0005, 0.0015},
+}
+
+// EstimateCost returns the USD cost of a generation, or 0 for unknown models
+func EstimateCost(model string, usage TokenUsage) float64 {
+	for _, price := range modelPrices {
+		if strings.HasPrefix(model, price.prefix) {
+			return float64(usage.PromptTokens)/1000*price.prompt + float64(usage.CompletionTokens)/1000*price.completion
+		}
+	}
+	return 0
+}
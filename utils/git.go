@@ -0,0 +1,237 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-autopilot/config"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// gitSinkBranchPrefix starts the name of every branch created by the git sink
+const gitSinkBranchPrefix = "autopilot/"
+
+// gitSinkMu serializes commits so two generations never race to create the same branch
+var gitSinkMu sync.Mutex
+
+// GitCommitResult identifies a commit made by the git sink
+type GitCommitResult struct {
+	Branch    string `json:"branch"`
+	CommitSHA string `json:"commitSha"`
+}
+
+// GitSinkEnabled reports whether git_sink.repo is configured
+func GitSinkEnabled() bool {
+	return config.Current().GitSink.Repo != ""
+}
+
+// CommitToGitSink commits files under <git_sink.path>/<name>/ on a new branch autopilot/<name>,
+// branched from git_sink.base_branch; name may be a path such as <tenant>/<artifact id>. The
+// repository is created if it does not exist. The commit is written directly to the object store,
+// leaving the worktree and any uncommitted changes as they are.
+func CommitToGitSink(name string, files map[string]string, message string) (*GitCommitResult, error) {
+	settings := config.Current().GitSink
+	repoPath := settings.Repo
+	if repoPath == "" {
+		return nil, fmt.Errorf("git sink is not configured (set GIT_SINK_REPO or git_sink.repo)")
+	}
+	baseBranch := settings.BaseBranch
+	targetDir := path.Join(settings.Path, name)
+	signature := &object.Signature{
+		Name:  settings.AuthorName,
+		Email: settings.AuthorEmail,
+		When:  time.Now(),
+	}
+
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" || strings.HasPrefix(segment, ".") {
+			return nil, fmt.Errorf("invalid name %q", name)
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for fileName := range files {
+		if fileName != path.Base(fileName) || strings.HasPrefix(fileName, ".") {
+			return nil, fmt.Errorf("invalid file name %q", fileName)
+		}
+		names = append(names, fileName)
+	}
+	sort.Strings(names)
+
+	gitSinkMu.Lock()
+	defer gitSinkMu.Unlock()
+
+	repo, err := openGitSink(repoPath, baseBranch, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	baseRef, err := repo.Reference(plumbing.NewBranchReferenceName(baseBranch), true)
+	if err != nil {
+		return nil, fmt.Errorf("base branch %q not found: %w", baseBranch, err)
+	}
+	baseCommit, err := repo.CommitObject(baseRef.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read base commit: %w", err)
+	}
+	baseTree, err := baseCommit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read base tree: %w", err)
+	}
+
+	branch := gitSinkBranchPrefix + name
+	branchRef := plumbing.NewBranchReferenceName(branch)
+	if _, err := repo.Reference(branchRef, false); err == nil {
+		return nil, fmt.Errorf("branch %q already exists", branch)
+	}
+
+	// Build the commit from objects only, so the worktree and its checked-out branch are never touched
+	blobs := map[string]plumbing.Hash{}
+	for _, fileName := range names {
+		hash, err := storeGitObject(repo, plumbing.BlobObject, []byte(files[fileName]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to store %s: %w", fileName, err)
+		}
+		blobs[fileName] = hash
+	}
+	treeHash, err := writeGitTree(repo, baseTree, strings.Split(targetDir, "/"), blobs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", targetDir, err)
+	}
+
+	commit := &object.Commit{
+		Author:       *signature,
+		Committer:    *signature,
+		Message:      message,
+		TreeHash:     treeHash,
+		ParentHashes: []plumbing.Hash{baseCommit.Hash},
+	}
+	encoded := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(encoded); err != nil {
+		return nil, fmt.Errorf("failed to encode commit: %w", err)
+	}
+	hash, err := repo.Storer.SetEncodedObject(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit: %w", err)
+	}
+
+	// Fails if another process created the branch since the check above
+	if err := repo.Storer.CheckAndSetReference(plumbing.NewHashReference(branchRef, hash), nil); err != nil {
+		return nil, fmt.Errorf("failed to create branch %q: %w", branch, err)
+	}
+
+	return &GitCommitResult{Branch: branch, CommitSHA: hash.String()}, nil
+}
+
+// writeGitTree stores a copy of tree (nil for an empty tree) with blobs placed in the directory
+// dir, replacing files of the same name, and returns the new tree's hash
+func writeGitTree(repo *git.Repository, tree *object.Tree, dir []string, blobs map[string]plumbing.Hash) (plumbing.Hash, error) {
+	entries := map[string]object.TreeEntry{}
+	if tree != nil {
+		for _, entry := range tree.Entries {
+			entries[entry.Name] = entry
+		}
+	}
+
+	if len(dir) == 0 {
+		for fileName, hash := range blobs {
+			entries[fileName] = object.TreeEntry{Name: fileName, Mode: filemode.Regular, Hash: hash}
+		}
+	} else {
+		var subtree *object.Tree
+		if entry, ok := entries[dir[0]]; ok {
+			if entry.Mode != filemode.Dir {
+				return plumbing.ZeroHash, fmt.Errorf("%s is a file, not a directory", dir[0])
+			}
+			var err error
+			if subtree, err = repo.TreeObject(entry.Hash); err != nil {
+				return plumbing.ZeroHash, err
+			}
+		}
+		hash, err := writeGitTree(repo, subtree, dir[1:], blobs)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		entries[dir[0]] = object.TreeEntry{Name: dir[0], Mode: filemode.Dir, Hash: hash}
+	}
+
+	// Git orders tree entries by name, comparing directories as if their name ended in "/"
+	sorted := &object.Tree{}
+	for _, entry := range entries {
+		sorted.Entries = append(sorted.Entries, entry)
+	}
+	sortKey := func(entry object.TreeEntry) string {
+		if entry.Mode == filemode.Dir {
+			return entry.Name + "/"
+		}
+		return entry.Name
+	}
+	sort.Slice(sorted.Entries, func(i, j int) bool {
+		return sortKey(sorted.Entries[i]) < sortKey(sorted.Entries[j])
+	})
+
+	encoded := repo.Storer.NewEncodedObject()
+	if err := sorted.Encode(encoded); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(encoded)
+}
+
+// storeGitObject writes a raw object such as a blob to the repository
+func storeGitObject(repo *git.Repository, objectType plumbing.ObjectType, content []byte) (plumbing.Hash, error) {
+	encoded := repo.Storer.NewEncodedObject()
+	encoded.SetType(objectType)
+	writer, err := encoded.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := writer.Write(content); err != nil {
+		writer.Close()
+		return plumbing.ZeroHash, err
+	}
+	if err := writer.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(encoded)
+}
+
+// openGitSink opens the sink repository, initializing it with an empty commit on the base branch if needed
+func openGitSink(repoPath, baseBranch string, signature *object.Signature) (*git.Repository, error) {
+	repo, err := git.PlainOpen(repoPath)
+	if err == nil {
+		return repo, nil
+	}
+	if !errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, fmt.Errorf("failed to open git repository %s: %w", repoPath, err)
+	}
+
+	repo, err = git.PlainInitWithOptions(repoPath, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName(baseBranch)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize git repository %s: %w", repoPath, err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open worktree: %w", err)
+	}
+	if _, err := worktree.Commit("Initialize generated Terraform repository", &git.CommitOptions{
+		Author:            signature,
+		Committer:         signature,
+		AllowEmptyCommits: true,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create initial commit: %w", err)
+	}
+
+	return repo, nil
+}
@@ -6,11 +6,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"strings"
 	"time"
+
+	"devops-autopilot/config"
 )
 
 // GitHubMessage represents a message in the chat completion request
@@ -32,60 +33,104 @@ type GitHubChoice struct {
 	Message GitHubMessage `json:"message"`
 }
 
+// GitHubUsage represents token usage in the response
+type GitHubUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
 // GitHubChatResponse represents the response from GitHub Models API
 type GitHubChatResponse struct {
+	Model   string         `json:"model"`
 	Choices []GitHubChoice `json:"choices"`
+	Usage   GitHubUsage    `json:"usage"`
 }
 
-var githubClient *http.Client
+// githubClient calls the GitHub Models API; each request carries its own timeout
+var githubClient = &http.Client{}
+
+// GitHubModel is an entry in the GitHub Models catalog
+type GitHubModel struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Task string `json:"task"`
+}
 
-// InitGitHub initializes the GitHub client
-func InitGitHub() {
-	githubClient = &http.Client{
-		Timeout: 30 * time.Second,
+// listGitHubModels returns the chat models in the GitHub Models catalog
+func listGitHubModels(ctx context.Context, token string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.Current().Providers.Copilot.BaseURL+"/models", nil)
+	if err != nil {
+		return nil, err
 	}
+	req.Header.Set("Authorization", "Bearer "+token)
 
-	// Validate GitHub token exists
-	token := os.Getenv("GITHUB_TOKEN")
-	if token == "" {
-		log.Println("Warning: GITHUB_TOKEN environment variable is not set - GitHub Copilot API will not work")
-		return
+	resp, err := githubClient.Do(req)
+	if err != nil {
+		if isTimeout(err) {
+			return nil, NewRetryableError(CodeProviderTimeout, "GitHub Models API timed out", err)
+		}
+		return nil, NewRetryableError(CodeProviderError, "failed to reach GitHub Models API", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, NewRetryableError(CodeProviderError, "failed to read GitHub Models API response", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, classifyGitHubModelsError(resp.StatusCode, string(body))
 	}
 
-	log.Println("GitHub client initialized successfully")
+	var catalog []GitHubModel
+	if err := json.Unmarshal(body, &catalog); err != nil {
+		return nil, NewRetryableError(CodeProviderError, "failed to parse GitHub Models catalog", err)
+	}
+	models := []string{}
+	for _, model := range catalog {
+		if model.Task != "" && model.Task != "chat-completion" {
+			continue
+		}
+		if model.Name != "" {
+			models = append(models, model.Name)
+		} else if model.ID != "" {
+			models = append(models, model.ID)
+		}
+	}
+	return models, nil
 }
 
-// GenerateTerraformCodeWithCopilot generates Terraform code using GitHub Models API
-func GenerateTerraformCodeWithCopilot(resource, specs string) (string, error) {
+// GenerateTerraformCodeWithCopilot generates Terraform code using GitHub Models API, grounded in optional
+// schema excerpts and following optional house conventions
+func GenerateTerraformCodeWithCopilot(ctx context.Context, resource, specs string, opts GenerationOptions) (out *GenerationOutput, err error) {
 	// Validate inputs
-	if githubClient == nil {
-		return "", fmt.Errorf("GitHub client not initialized")
+	if err := CheckProvider("copilot", opts.APIKey); err != nil {
+		return nil, err
 	}
 
-	token := os.Getenv("GITHUB_TOKEN")
+	settings := config.Current()
+	token := opts.APIKey
 	if token == "" {
-		return "", fmt.Errorf("GITHUB_TOKEN environment variable is not set")
+		token = settings.GitHub.Token
 	}
 
 	if strings.TrimSpace(resource) == "" {
-		return "", fmt.Errorf("resource cannot be empty")
+		return nil, NewError(CodeInvalidRequest, "resource cannot be empty", nil)
 	}
 
 	if strings.TrimSpace(specs) == "" {
-		return "", fmt.Errorf("specs cannot be empty")
+		return nil, NewError(CodeInvalidRequest, "specs cannot be empty", nil)
 	}
 
-	log.Printf("Generating Terraform code using GitHub Copilot for resource: %s with specs: %s", resource, specs)
+	slog.InfoContext(ctx, "Generating Terraform code", "provider", "copilot", "resource", resource)
 
-	prompt := fmt.Sprintf(`You are a Terraform expert. Generate Terraform code to provision the following:
-
-Resource: %s
-Specs: %s
-
-Only output valid Terraform code inside one block. Do not explain anything.
-The code should be production-ready and follow best practices.`, resource, specs)
+	prompt, promptVersion, err := buildPrompt(settings.Prompts, settings.Prompts.Copilot, copilotPromptTemplate, resource, specs, opts)
+	if err != nil {
+		return nil, err
+	}
 
 	// Prepare the request
+	provider := settings.Providers.Copilot
 	request := GitHubChatRequest{
 		Messages: []GitHubMessage{
 			{
@@ -93,24 +138,25 @@ The code should be production-ready and follow best practices.`, resource, specs
 				Content: prompt,
 			},
 		},
-		Model:       "gpt-4o-mini", // Using GPT-4o-mini for cost efficiency
-		MaxTokens:   2000,
-		Temperature: 0.2,
+		Model:       provider.Model,
+		MaxTokens:   provider.MaxTokens,
+		Temperature: float64(provider.Temperature),
 	}
+	slog.DebugContext(ctx, "Provider prompt", "provider", "copilot", "model", request.Model, "prompt_chars", len(prompt), "prompt_sha256", textDigest(prompt))
 
 	// Convert to JSON
 	jsonData, err := json.Marshal(request)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Create HTTP request
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, provider.Timeout.Std())
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://models.inference.ai.azure.com/chat/completions", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", provider.BaseURL+"/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
@@ -118,40 +164,74 @@ The code should be production-ready and follow best practices.`, resource, specs
 	req.Header.Set("Authorization", "Bearer "+token)
 
 	// Make the request
+	ctx, span := startProviderSpan(ctx, "copilot", request.Model)
+	start := time.Now()
+	defer func() {
+		observeGeneration("copilot", request.Model, start, out, err)
+		endProviderSpan(span, out, err)
+	}()
+
 	resp, err := githubClient.Do(req)
 	if err != nil {
-		log.Printf("Error calling GitHub Models API: %v", err)
-		return "", fmt.Errorf("failed to call GitHub Models API: %w", err)
+		slog.WarnContext(ctx, "GitHub Models API call failed", "error", err)
+		if isTimeout(err) {
+			return nil, NewRetryableError(CodeProviderTimeout, "GitHub Models API timed out", err)
+		}
+		return nil, NewRetryableError(CodeProviderError, "failed to call GitHub Models API", err)
 	}
 	defer resp.Body.Close()
 
 	// Read response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
+		return nil, NewRetryableError(CodeProviderError, "failed to read GitHub Models API response", err)
 	}
 
 	// Check for HTTP errors
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("GitHub Models API returned status %d: %s", resp.StatusCode, string(body))
-		return "", fmt.Errorf("GitHub Models API error (status %d): %s", resp.StatusCode, string(body))
+		slog.WarnContext(ctx, "GitHub Models API returned an error", "status", resp.StatusCode, "body", truncate(string(body), 1024))
+		return nil, classifyGitHubModelsError(resp.StatusCode, string(body))
 	}
 
 	// Parse response
 	var response GitHubChatResponse
 	if err := json.Unmarshal(body, &response); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+		return nil, NewRetryableError(CodeProviderError, "failed to parse GitHub Models API response", err)
 	}
 
 	if len(response.Choices) == 0 {
-		return "", fmt.Errorf("no response choices from GitHub Models API")
+		return nil, NewRetryableError(CodeEmptyOutput, "no response choices from GitHub Models API", nil)
 	}
 
 	content := response.Choices[0].Message.Content
 	if strings.TrimSpace(content) == "" {
-		return "", fmt.Errorf("GitHub Models API returned empty content")
+		return nil, NewRetryableError(CodeEmptyOutput, "GitHub Models API returned empty content", nil)
 	}
 
-	log.Printf("Successfully generated Terraform code using GitHub Copilot (%d characters)", len(content))
-	return content, nil
+	slog.InfoContext(ctx, "Generated Terraform code", "provider", "copilot", "model", response.Model,
+		"chars", len(content), "total_tokens", response.Usage.TotalTokens)
+	slog.DebugContext(ctx, "Provider response", "provider", "copilot", "content_chars", len(content), "content_sha256", textDigest(content))
+
+	model := response.Model
+	if model == "" {
+		model = request.Model
+	}
+	return &GenerationOutput{
+		Content: content,
+		Model:   model,
+		Usage: TokenUsage{
+			PromptTokens:     response.Usage.PromptTokens,
+			CompletionTokens: response.Usage.CompletionTokens,
+			TotalTokens:      response.Usage.TotalTokens,
+		},
+		PromptVersion: promptVersion,
+	}, nil
+}
+
+// truncate shortens text for logs, marking the cut
+func truncate(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	return text[:max] + "...(truncated)"
 }
@@ -0,0 +1,267 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"devops-autopilot/config"
+)
+
+// githubRepoPattern matches an owner/name repository reference
+var githubRepoPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+
+// githubAPIClient is used for GitHub REST API calls
+var githubAPIClient = &http.Client{Timeout: 30 * time.Second}
+
+// PullRequestOptions describes a pull request that adds generated files to a repository
+type PullRequestOptions struct {
+	Repo          string            // owner/name
+	BaseBranch    string            // defaults to the repository's default branch
+	Branch        string            // new branch to create
+	Files         map[string]string // repository path -> content
+	CommitMessage string
+	Title         string
+	Body          string
+	Draft         bool
+	Token         string // GitHub token to use instead of github.token, e.g. a tenant's own
+}
+
+// PullRequestResult identifies an opened pull request
+type PullRequestResult struct {
+	Number    int    `json:"number"`
+	URL       string `json:"url"`
+	Repo      string `json:"repo"`
+	Branch    string `json:"branch"`
+	CommitSHA string `json:"commitSha"`
+}
+
+// ValidGitHubRepo reports whether repo is an owner/name reference
+func ValidGitHubRepo(repo string) bool {
+	return githubRepoPattern.MatchString(repo)
+}
+
+// OpenPullRequest pushes files as a single commit on a new branch and opens a pull request,
+// using the git data API so no clone is needed
+func OpenPullRequest(ctx context.Context, opts PullRequestOptions) (*PullRequestResult, error) {
+	token := opts.Token
+	if token == "" {
+		token = config.Current().GitHub.Token
+	}
+	if token == "" {
+		return nil, NewError(CodeProviderNotConfigured, "GitHub token is not configured (set GITHUB_TOKEN)", nil)
+	}
+	if !ValidGitHubRepo(opts.Repo) {
+		return nil, NewError(CodeInvalidRequest, fmt.Sprintf("invalid repository %q (expected owner/name)", opts.Repo), nil)
+	}
+	if len(opts.Files) == 0 {
+		return nil, NewError(CodeInvalidRequest, "no files to commit", nil)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	repoPath := "/repos/" + opts.Repo
+
+	// Resolve the base branch and its head commit
+	baseBranch := opts.BaseBranch
+	if baseBranch == "" {
+		var repo struct {
+			DefaultBranch string `json:"default_branch"`
+		}
+		if err := githubAPI(ctx, token, http.MethodGet, repoPath, nil, &repo); err != nil {
+			return nil, err
+		}
+		baseBranch = repo.DefaultBranch
+	}
+
+	var baseRef struct {
+		Object struct {
+			SHA string `json:"sha"`
+		} `json:"object"`
+	}
+	if err := githubAPI(ctx, token, http.MethodGet, repoPath+"/git/ref/heads/"+escapeRef(baseBranch), nil, &baseRef); err != nil {
+		return nil, err
+	}
+
+	var baseCommit struct {
+		Tree struct {
+			SHA string `json:"sha"`
+		} `json:"tree"`
+	}
+	if err := githubAPI(ctx, token, http.MethodGet, repoPath+"/git/commits/"+baseRef.Object.SHA, nil, &baseCommit); err != nil {
+		return nil, err
+	}
+
+	// Build a tree with the new files on top of the base tree
+	type treeEntry struct {
+		Path    string `json:"path"`
+		Mode    string `json:"mode"`
+		Type    string `json:"type"`
+		Content string `json:"content"`
+	}
+	paths := make([]string, 0, len(opts.Files))
+	for filePath := range opts.Files {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+
+	entries := make([]treeEntry, 0, len(paths))
+	for _, filePath := range paths {
+		entries = append(entries, treeEntry{Path: filePath, Mode: "100644", Type: "blob", Content: opts.Files[filePath]})
+	}
+
+	var tree struct {
+		SHA string `json:"sha"`
+	}
+	if err := githubAPI(ctx, token, http.MethodPost, repoPath+"/git/trees", map[string]interface{}{
+		"base_tree": baseCommit.Tree.SHA,
+		"tree":      entries,
+	}, &tree); err != nil {
+		return nil, err
+	}
+
+	var commit struct {
+		SHA string `json:"sha"`
+	}
+	if err := githubAPI(ctx, token, http.MethodPost, repoPath+"/git/commits", map[string]interface{}{
+		"message": opts.CommitMessage,
+		"tree":    tree.SHA,
+		"parents": []string{baseRef.Object.SHA},
+	}, &commit); err != nil {
+		return nil, err
+	}
+
+	if err := githubAPI(ctx, token, http.MethodPost, repoPath+"/git/refs", map[string]interface{}{
+		"ref": "refs/heads/" + opts.Branch,
+		"sha": commit.SHA,
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	var pull struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := githubAPI(ctx, token, http.MethodPost, repoPath+"/pulls", map[string]interface{}{
+		"title": opts.Title,
+		"head":  opts.Branch,
+		"base":  baseBranch,
+		"body":  opts.Body,
+		"draft": opts.Draft,
+	}, &pull); err != nil {
+		// Remove the branch so a retry can create it again; ctx may already be spent or canceled
+		cleanupCtx, cancelCleanup := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancelCleanup()
+		if deleteErr := githubAPI(cleanupCtx, token, http.MethodDelete, repoPath+"/git/refs/heads/"+escapeRef(opts.Branch), nil, nil); deleteErr != nil {
+			slog.WarnContext(ctx, "Failed to delete branch after pull request creation failed", "repo", opts.Repo, "branch", opts.Branch, "error", deleteErr)
+		}
+		return nil, err
+	}
+
+	return &PullRequestResult{
+		Number:    pull.Number,
+		URL:       pull.HTMLURL,
+		Repo:      opts.Repo,
+		Branch:    opts.Branch,
+		CommitSHA: commit.SHA,
+	}, nil
+}
+
+// githubAPI sends a GitHub REST API request and decodes the JSON response into out (if not nil)
+func githubAPI(ctx context.Context, token, method, apiPath string, body interface{}, out interface{}) error {
+	baseURL := strings.TrimRight(config.Current().GitHub.APIURL, "/")
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, baseURL+apiPath, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := githubAPIClient.Do(req)
+	if err != nil {
+		return NewRetryableError(CodeGitHubError, fmt.Sprintf("failed to call GitHub API %s %s", method, apiPath), err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return NewRetryableError(CodeGitHubError, "failed to read GitHub API response", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message := fmt.Sprintf("GitHub API error on %s %s (status %d)", method, apiPath, resp.StatusCode)
+		if reason := githubErrorMessage(respBody); reason != "" {
+			message += ": " + reason
+		}
+		return &Error{
+			Code:      CodeGitHubError,
+			Message:   message,
+			Retryable: resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500,
+		}
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return NewError(CodeGitHubError, "failed to parse GitHub API response", err)
+		}
+	}
+	return nil
+}
+
+// githubErrorMessage extracts the messages of a GitHub API error response, such as
+// "Validation Failed: A pull request already exists", leaving out the rest of the body
+func githubErrorMessage(body []byte) string {
+	var parsed struct {
+		Message string `json:"message"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return ""
+	}
+	messages := []string{}
+	if parsed.Message != "" {
+		messages = append(messages, parsed.Message)
+	}
+	for _, detail := range parsed.Errors {
+		if detail.Message != "" {
+			messages = append(messages, detail.Message)
+		}
+	}
+	return strings.Join(messages, ": ")
+}
+
+// escapeRef escapes each segment of a branch name for use in a URL path
+func escapeRef(ref string) string {
+	segments := strings.Split(ref, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return path.Join(segments...)
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-autopilot/config"
+)
+
+// GitHubIssueCommentEvent is the subset of an issue_comment webhook payload used for ChatOps
+type GitHubIssueCommentEvent struct {
+	Action string `json:"action"`
+	Issue  struct {
+		Number      int       `json:"number"`
+		PullRequest *struct{} `json:"pull_request"` // set when the issue is a pull request
+	} `json:"issue"`
+	Comment struct {
+		ID   int64  `json:"id"`
+		Body string `json:"body"`
+		User struct {
+			Login string `json:"login"`
+			Type  string `json:"type"` // User or Bot
+		} `json:"user"`
+		AuthorAssociation string `json:"author_association"` // OWNER, MEMBER, COLLABORATOR, CONTRIBUTOR, NONE, ...
+	} `json:"comment"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// trustedAssociations may run ChatOps commands without being on the allow-list
+var trustedAssociations = map[string]bool{"OWNER": true, "MEMBER": true, "COLLABORATOR": true}
+
+// deliveryTTL is how long webhook delivery IDs are remembered; GitHub redeliveries keep the same ID
+const deliveryTTL = 24 * time.Hour
+
+var (
+	deliveriesMu    sync.Mutex
+	deliveries      = map[string]time.Time{} // delivery ID -> when it was claimed
+	deliveriesSwept time.Time
+)
+
+// ChatOpsAllowed reports whether a commenter may run ChatOps commands: repository owners, members
+// and collaborators always may, anyone else only when listed in github.chatops_allowed_users
+func ChatOpsAllowed(login, association string) bool {
+	if trustedAssociations[association] {
+		return true
+	}
+	for _, allowed := range config.Current().GitHub.ChatOpsAllowedUsers {
+		if strings.EqualFold(allowed, login) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimDelivery records a webhook delivery ID, returning false when it was already claimed.
+// Expired IDs are swept at most once a minute.
+func ClaimDelivery(id string) bool {
+	deliveriesMu.Lock()
+	defer deliveriesMu.Unlock()
+
+	now := time.Now()
+	if now.Sub(deliveriesSwept) > time.Minute {
+		for claimed, at := range deliveries {
+			if now.Sub(at) > deliveryTTL {
+				delete(deliveries, claimed)
+			}
+		}
+		deliveriesSwept = now
+	}
+
+	if at, seen := deliveries[id]; seen && now.Sub(at) <= deliveryTTL {
+		return false
+	}
+	deliveries[id] = now
+	return true
+}
+
+// ReleaseDelivery forgets a claimed delivery that was not processed, so a redelivery can run
+func ReleaseDelivery(id string) {
+	deliveriesMu.Lock()
+	delete(deliveries, id)
+	deliveriesMu.Unlock()
+}
+
+// GitHubWebhookSecret returns the shared secret configured for the GitHub webhook, or ""
+func GitHubWebhookSecret() string {
+	return config.Current().GitHub.WebhookSecret
+}
+
+// VerifyGitHubSignature checks an X-Hub-Signature-256 header ("sha256=<hex>") against the payload
+func VerifyGitHubSignature(secret string, payload []byte, header string) bool {
+	if secret == "" || !strings.HasPrefix(header, "sha256=") {
+		return false
+	}
+	signature, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+// CreateIssueComment posts a comment on an issue or pull request. An empty token uses github.token.
+func CreateIssueComment(ctx context.Context, token, repo string, number int, body string) error {
+	if token == "" {
+		token = config.Current().GitHub.Token
+	}
+	if token == "" {
+		return fmt.Errorf("GitHub token is not configured")
+	}
+	if !ValidGitHubRepo(repo) {
+		return fmt.Errorf("invalid repository %q (expected owner/name)", repo)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	return githubAPI(ctx, token, http.MethodPost, fmt.Sprintf("/repos/%s/issues/%d/comments", repo, number), map[string]string{
+		"body": body,
+	}, nil)
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"devops-autopilot/config"
+)
+
+// terraformVersionTTL is how long a detected terraform version is reused by readiness checks
+const terraformVersionTTL = 5 * time.Minute
+
+var (
+	terraformVersionMu      sync.Mutex
+	terraformVersionCached  string
+	terraformVersionChecked time.Time
+)
+
+// TerraformVersion returns the version of the terraform CLI, or an error when it is missing or broken
+func TerraformVersion(ctx context.Context) (string, error) {
+	terraformVersionMu.Lock()
+	defer terraformVersionMu.Unlock()
+
+	if terraformVersionCached != "" && time.Since(terraformVersionChecked) < terraformVersionTTL {
+		return terraformVersionCached, nil
+	}
+
+	if !isTerraformInstalled() {
+		return "", fmt.Errorf("terraform CLI is not installed or not available in PATH")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "terraform", "version", "-json").Output()
+	if err != nil {
+		return "", fmt.Errorf("terraform version failed: %w", err)
+	}
+
+	var version struct {
+		TerraformVersion string `json:"terraform_version"`
+	}
+	if err := json.Unmarshal(output, &version); err != nil || version.TerraformVersion == "" {
+		return "", fmt.Errorf("unexpected terraform version output: %s", output)
+	}
+
+	terraformVersionCached = version.TerraformVersion
+	terraformVersionChecked = time.Now()
+	return terraformVersionCached, nil
+}
+
+// TFLintAvailable reports whether tflint is installed for lint stages
+func TFLintAvailable() bool {
+	return isTFLintInstalled()
+}
+
+// PluginCacheDir returns the configured terraform plugin cache directory, or "" when unset
+func PluginCacheDir() string {
+	return config.Current().Terraform.PluginCacheDir
+}
+
+// CheckWritable verifies that a file can be created in dir
+func CheckWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".autopilot-probe-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// PingOpenAI checks that the OpenAI API is reachable and accepts the service-wide key
+func PingOpenAI(ctx context.Context) error {
+	if err := CheckProvider("openai", ""); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if _, err := openAIClientFor("").ListModels(ctx); err != nil {
+		return classifyOpenAIError(err)
+	}
+	return nil
+}
+
+// PingGitHubModels checks that the GitHub Models API is reachable and accepts the service-wide token
+func PingGitHubModels(ctx context.Context) error {
+	if err := CheckProvider("copilot", ""); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.Current().Providers.Copilot.BaseURL+"/models", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.Current().GitHub.Token)
+
+	resp, err := githubClient.Do(req)
+	if err != nil {
+		if isTimeout(err) {
+			return NewRetryableError(CodeProviderTimeout, "GitHub Models API timed out", err)
+		}
+		return NewRetryableError(CodeProviderError, "failed to reach GitHub Models API", err)
+	}
+	resp.Body.Close()
+
+	// Any answer short of an auth failure or server error shows the API is reachable
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden || resp.StatusCode >= 500 {
+		return classifyGitHubModelsError(resp.StatusCode, "")
+	}
+	return nil
+}
@@ -0,0 +1,404 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// minimumTerraformVersion is written to versions.tf of generated modules
+const minimumTerraformVersion = ">= 1.3.0"
+
+// moduleFileOrder is the order files are returned in
+var moduleFileOrder = []string{"main.tf", "variables.tf", "outputs.tf", "versions.tf", "README.md"}
+
+// defaultProviderVersions pins well-known providers when no cached schema tells us the version in use
+var defaultProviderVersions = map[string]string{
+	"aws":        "~> 5.0",
+	"azurerm":    "~> 3.0",
+	"google":     "~> 5.0",
+	"kubernetes": "~> 2.0",
+	"helm":       "~> 2.0",
+	"random":     "~> 3.0",
+	"tls":        "~> 4.0",
+	"null":       "~> 3.0",
+	"local":      "~> 2.0",
+}
+
+// providerSources maps well-known providers outside the hashicorp namespace to their registry source
+var providerSources = map[string]string{
+	"cloudflare":   "cloudflare/cloudflare",
+	"datadog":      "DataDog/datadog",
+	"digitalocean": "digitalocean/digitalocean",
+	"github":       "integrations/github",
+	"kubectl":      "gavinbunney/kubectl",
+	"mongodbatlas": "mongodb/mongodbatlas",
+	"newrelic":     "newrelic/newrelic",
+	"pagerduty":    "PagerDuty/pagerduty",
+	"snowflake":    "Snowflake-Labs/snowflake",
+}
+
+// builtInProviders are not declared in required_providers
+var builtInProviders = map[string]bool{
+	"terraform": true,
+}
+
+// ModuleFile is a single file of a generated module
+type ModuleFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// ModuleLayout is a generated module split into the standard files
+type ModuleLayout struct {
+	Files []ModuleFile `json:"files"`
+}
+
+// FileMap returns the module as file name to content
+func (m *ModuleLayout) FileMap() map[string]string {
+	files := make(map[string]string, len(m.Files))
+	for _, file := range m.Files {
+		files[file.Path] = file.Content
+	}
+	return files
+}
+
+// BuildModuleLayout splits terraform code into main.tf, variables.tf, outputs.tf, versions.tf and a README
+func BuildModuleLayout(code, variablesTF, resource, specs string) (*ModuleLayout, error) {
+	file, diags := hclwrite.ParseConfig([]byte(code), "main.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse terraform code: %s", diags.Error())
+	}
+
+	var main, variables, outputs, versions []string
+	if strings.TrimSpace(variablesTF) != "" {
+		variables = append(variables, strings.TrimSpace(variablesTF))
+	}
+
+	var resources []outputResource // managed resources, for default outputs
+	providers := map[string]bool{}
+	var terraformBlocks []*hclwrite.Block // rendered once providers are known
+
+	for _, block := range file.Body().Blocks() {
+		text := strings.TrimSpace(string(block.BuildTokens(nil).Bytes()))
+		labels := block.Labels()
+
+		switch block.Type() {
+		case "variable":
+			variables = append(variables, text)
+		case "output":
+			outputs = append(outputs, text)
+		case "terraform":
+			terraformBlocks = append(terraformBlocks, block)
+		default:
+			main = append(main, text)
+			if (block.Type() == "resource" || block.Type() == "data") && len(labels) == 2 {
+				providers[providerFromType(labels[0])] = true
+				if block.Type() == "resource" {
+					resources = append(resources, outputResource{
+						address: labels[0] + "." + labels[1],
+						count:   block.Body().GetAttribute("count") != nil,
+						forEach: block.Body().GetAttribute("for_each") != nil,
+					})
+				}
+			}
+			if block.Type() == "provider" && len(labels) == 1 {
+				providers[labels[0]] = true
+			}
+		}
+	}
+
+	// Expose the ID of every managed resource when the model did not declare outputs
+	if len(outputs) == 0 {
+		for _, resource := range resources {
+			outputs = append(outputs, resource.output(outputs))
+		}
+	}
+
+	// Pin every provider in use, merging into the model's own required_providers when it declared them
+	hasRequiredProviders := false
+	for _, block := range terraformBlocks {
+		for _, nested := range block.Body().Blocks() {
+			if nested.Type() == "required_providers" && !hasRequiredProviders {
+				mergeRequiredProviders(nested.Body(), providers)
+				hasRequiredProviders = true
+			}
+		}
+		versions = append(versions, strings.TrimSpace(string(block.BuildTokens(nil).Bytes())))
+	}
+	if !hasRequiredProviders {
+		versions = append(versions, requiredProvidersBlock(providers, len(versions) == 0))
+	}
+
+	files := map[string]string{
+		"main.tf":      joinBlocks(main),
+		"variables.tf": joinBlocks(variables),
+		"outputs.tf":   joinBlocks(outputs),
+		"versions.tf":  joinBlocks(versions),
+	}
+	files["README.md"] = moduleReadme(resource, specs, files, providers)
+
+	layout := &ModuleLayout{}
+	for _, path := range moduleFileOrder {
+		layout.Files = append(layout.Files, ModuleFile{Path: path, Content: files[path]})
+	}
+	return layout, nil
+}
+
+// outputResource is a managed resource that gets a default output
+type outputResource struct {
+	address string // aws_route_table.public
+	count   bool   // the resource sets count, so it is a list of instances
+	forEach bool   // the resource sets for_each, so it is a map of instances
+}
+
+// output renders an output exposing the resource's ID, or the IDs of all its instances
+func (r outputResource) output(existing []string) string {
+	// aws_route_table.public -> route_table_public_id
+	parts := strings.SplitN(r.address, ".", 2)
+	typeName := strings.TrimPrefix(parts[0], providerFromType(parts[0])+"_")
+	suffix, description, value := "_id", "ID of "+r.address, r.address+".id"
+	switch {
+	case r.forEach:
+		suffix, description, value = "_ids", "IDs of "+r.address+" by key", fmt.Sprintf("{ for key, instance in %s : key => instance.id }", r.address)
+	case r.count:
+		suffix, description, value = "_ids", "IDs of "+r.address, r.address+"[*].id"
+	}
+	name := sanitizeIdentifier(typeName + "_" + parts[1] + suffix)
+	return fmt.Sprintf("output %q {\n  description = %q\n  value = %s\n}", uniqueOutputName(name, existing), description, value)
+}
+
+// providerFromType returns the provider local name of a resource type (aws_instance -> aws)
+func providerFromType(typeName string) string {
+	if i := strings.Index(typeName, "_"); i > 0 {
+		return typeName[:i]
+	}
+	return typeName
+}
+
+// requiredProvidersBlock renders a terraform block pinning every provider used by the module
+func requiredProvidersBlock(providers map[string]bool, withVersion bool) string {
+	var sb strings.Builder
+	sb.WriteString("terraform {\n")
+	if withVersion {
+		sb.WriteString(fmt.Sprintf("  required_version = %q\n\n", minimumTerraformVersion))
+	}
+	sb.WriteString("  required_providers {\n")
+	for _, name := range requiredProviderNames(providers) {
+		sb.WriteString(fmt.Sprintf("    %s = {\n      source = %q\n", name, providerSource(name)))
+		if version := providerVersionConstraint(name); version != "" {
+			sb.WriteString(fmt.Sprintf("      version = %q\n", version))
+		}
+		sb.WriteString("    }\n")
+	}
+	sb.WriteString("  }\n}")
+	return sb.String()
+}
+
+// mergeRequiredProviders adds the source and version of every provider in use to the model's
+// required_providers block, keeping whatever the model already declared for it
+func mergeRequiredProviders(body *hclwrite.Body, providers map[string]bool) {
+	for _, name := range requiredProviderNames(providers) {
+		var items []hclwrite.ObjectAttrTokens
+		declared := map[string]bool{}
+
+		if attr := body.GetAttribute(name); attr != nil {
+			src := attr.Expr().BuildTokens(nil).Bytes()
+			expr, diags := hclsyntax.ParseExpression(src, "versions.tf", hcl.InitialPos)
+			if diags.HasErrors() {
+				continue
+			}
+			switch expr := expr.(type) {
+			case *hclsyntax.ObjectConsExpr:
+				for _, item := range expr.Items {
+					key, keyDiags := item.KeyExpr.Value(nil)
+					if keyDiags.HasErrors() || key.Type() != cty.String || !key.IsKnown() {
+						continue
+					}
+					declared[key.AsString()] = true
+					items = append(items, hclwrite.ObjectAttrTokens{
+						Name:  rawTokens(src, item.KeyExpr.Range()),
+						Value: rawTokens(src, item.ValueExpr.Range()),
+					})
+				}
+			case *hclsyntax.TemplateExpr:
+				// Legacy shorthand: aws = "~> 5.0" declares only the version
+				declared["version"] = true
+				items = append(items, hclwrite.ObjectAttrTokens{
+					Name:  hclwrite.TokensForIdentifier("version"),
+					Value: rawTokens(src, expr.Range()),
+				})
+			default:
+				continue
+			}
+		}
+
+		version := providerVersionConstraint(name)
+		if declared["source"] && (declared["version"] || version == "") {
+			continue
+		}
+		if !declared["source"] {
+			items = append([]hclwrite.ObjectAttrTokens{{
+				Name:  hclwrite.TokensForIdentifier("source"),
+				Value: hclwrite.TokensForValue(cty.StringVal(providerSource(name))),
+			}}, items...)
+		}
+		if !declared["version"] && version != "" {
+			items = append(items, hclwrite.ObjectAttrTokens{
+				Name:  hclwrite.TokensForIdentifier("version"),
+				Value: hclwrite.TokensForValue(cty.StringVal(version)),
+			})
+		}
+		body.SetAttributeRaw(name, hclwrite.TokensForObject(items))
+	}
+}
+
+// rawTokens wraps a range of src as a single token; the file is re-lexed when it is formatted
+func rawTokens(src []byte, rng hcl.Range) hclwrite.Tokens {
+	return hclwrite.Tokens{{Type: hclsyntax.TokenIdent, Bytes: src[rng.Start.Byte:rng.End.Byte]}}
+}
+
+// requiredProviderNames returns the providers to declare in required_providers, sorted
+func requiredProviderNames(providers map[string]bool) []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		if !builtInProviders[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// providerSource returns a provider's registry source from its cached schema or the well-known
+// sources, falling back to the hashicorp namespace as terraform itself does
+func providerSource(name string) string {
+	for _, schema := range latestCachedSchemas() {
+		if schema.Source[strings.LastIndex(schema.Source, "/")+1:] == name {
+			return strings.TrimPrefix(schema.Source, "registry.terraform.io/")
+		}
+	}
+	if source, ok := providerSources[name]; ok {
+		return source
+	}
+	return "hashicorp/" + name
+}
+
+// providerVersionConstraint pins a provider to the minor version of its cached schema, or a known default
+func providerVersionConstraint(name string) string {
+	for _, schema := range latestCachedSchemas() {
+		if schema.Source[strings.LastIndex(schema.Source, "/")+1:] != name {
+			continue
+		}
+		parts := strings.Split(schema.Version, ".")
+		if len(parts) >= 2 {
+			return fmt.Sprintf("~> %s.%s", parts[0], parts[1])
+		}
+	}
+	return defaultProviderVersions[name]
+}
+
+// joinBlocks joins rendered blocks into a formatted file
+func joinBlocks(blocks []string) string {
+	if len(blocks) == 0 {
+		return ""
+	}
+	return string(hclwrite.Format([]byte(strings.Join(blocks, "\n\n") + "\n")))
+}
+
+// uniqueOutputName avoids duplicate output names when two resources share a name
+func uniqueOutputName(name string, existing []string) string {
+	taken := map[string]bool{}
+	for _, output := range existing {
+		if fields := strings.Fields(output); len(fields) > 1 {
+			taken[strings.Trim(fields[1], `"`)] = true
+		}
+	}
+	return uniqueVariableName(name, taken)
+}
+
+// moduleReadme documents the module's purpose, requirements, inputs and outputs
+func moduleReadme(resource, specs string, files map[string]string, providers map[string]bool) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("# %s\n\n", strings.TrimSpace(resource)))
+	if strings.TrimSpace(specs) != "" {
+		sb.WriteString(strings.TrimSpace(specs) + "\n\n")
+	}
+	sb.WriteString("Generated by DevOps Autopilot. Review before applying.\n\n")
+
+	sb.WriteString("## Usage\n\n```hcl\nmodule \"this\" {\n  source = \"./path/to/this/module\"\n}\n```\n\n")
+
+	sb.WriteString("## Requirements\n\n| Name | Version |\n|------|---------|\n")
+	sb.WriteString(fmt.Sprintf("| terraform | %s |\n", minimumTerraformVersion))
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		if !builtInProviders[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("| %s | %s |\n", name, providerVersionConstraint(name)))
+	}
+
+	sb.WriteString("\n## Inputs\n\n")
+	inputs := readmeBlockRows(files["variables.tf"], "variable", []string{"description", "type", "default"})
+	if len(inputs) == 0 {
+		sb.WriteString("No inputs.\n")
+	} else {
+		sb.WriteString("| Name | Description | Type | Default |\n|------|-------------|------|---------|\n")
+		for _, row := range inputs {
+			sb.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		}
+	}
+
+	sb.WriteString("\n## Outputs\n\n")
+	outputs := readmeBlockRows(files["outputs.tf"], "output", []string{"description"})
+	if len(outputs) == 0 {
+		sb.WriteString("No outputs.\n")
+	} else {
+		sb.WriteString("| Name | Description |\n|------|-------------|\n")
+		for _, row := range outputs {
+			sb.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// readmeBlockRows returns the name and selected attribute sources of each labelled block of a type
+func readmeBlockRows(src, blockType string, attrNames []string) [][]string {
+	file, diags := hclsyntax.ParseConfig([]byte(src), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil
+	}
+
+	var rows [][]string
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if block.Type != blockType || len(block.Labels) != 1 {
+			continue
+		}
+		row := []string{"`" + block.Labels[0] + "`"}
+		for _, name := range attrNames {
+			attr, ok := block.Body.Attributes[name]
+			if !ok {
+				row = append(row, "n/a")
+				continue
+			}
+			if value, diags := attr.Expr.Value(nil); !diags.HasErrors() && name == "description" && value.Type().FriendlyName() == "string" {
+				row = append(row, strings.ReplaceAll(value.AsString(), "|", "\\|"))
+				continue
+			}
+			raw := strings.TrimSpace(string(attr.Expr.Range().SliceBytes([]byte(src))))
+			row = append(row, "`"+strings.ReplaceAll(raw, "|", "\\|")+"`")
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
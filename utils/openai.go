@@ -2,85 +2,140 @@ package utils
 
 import (
 	"context"
-	"fmt"
-	"log"
-	"os"
+	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
+	"devops-autopilot/config"
+
 	"github.com/sashabaranov/go-openai"
 )
 
-var openaiClient *openai.Client
+// openAIClients caches clients by a hash of their API key, so a key added by a configuration reload
+// or a tenant gets its own client. ResetOpenAIClients drops them when keys may have changed.
+var openAIClients sync.Map
 
-// InitOpenAI initializes the OpenAI client
-func InitOpenAI() {
-	apiKey := os.Getenv("OPENAI_API_KEY")
+// openAIClientFor returns the client for a per-tenant API key, or for the service-wide key when
+// apiKey is empty
+func openAIClientFor(apiKey string) *openai.Client {
 	if apiKey == "" {
-		log.Fatal("OPENAI_API_KEY environment variable is not set")
+		apiKey = config.Current().Providers.OpenAI.APIKey
+	}
+	key := credentialKey(apiKey)
+	if client, ok := openAIClients.Load(key); ok {
+		return client.(*openai.Client)
 	}
+	client, _ := openAIClients.LoadOrStore(key, openai.NewClient(apiKey))
+	return client.(*openai.Client)
+}
 
-	openaiClient = openai.NewClient(apiKey)
-	log.Println("OpenAI client initialized successfully")
+// ResetOpenAIClients drops every cached client, so replaced keys are not kept in memory; call it
+// after a configuration reload or a tenant update
+func ResetOpenAIClients() {
+	openAIClients.Range(func(key, _ interface{}) bool {
+		openAIClients.Delete(key)
+		return true
+	})
 }
 
-// GenerateTerraformCode generates Terraform code using OpenAI API
-func GenerateTerraformCode(resource, specs string) (string, error) {
+// chatModelPrefixes select the OpenAI models that can serve chat completions
+var chatModelPrefixes = []string{"gpt-", "o1", "o3", "o4"}
+
+// listOpenAIModels returns the chat models available to a client
+func listOpenAIModels(ctx context.Context, client *openai.Client) ([]string, error) {
+	list, err := client.ListModels(ctx)
+	if err != nil {
+		return nil, classifyOpenAIError(err)
+	}
+	models := []string{}
+	for _, model := range list.Models {
+		for _, prefix := range chatModelPrefixes {
+			if strings.HasPrefix(model.ID, prefix) {
+				models = append(models, model.ID)
+				break
+			}
+		}
+	}
+	return models, nil
+}
+
+// GenerateTerraformCode generates Terraform code using OpenAI API, grounded in optional schema excerpts
+// and following optional house conventions
+func GenerateTerraformCode(ctx context.Context, resource, specs string, opts GenerationOptions) (out *GenerationOutput, err error) {
 	// Validate inputs
-	if openaiClient == nil {
-		return "", fmt.Errorf("OpenAI client not initialized")
+	if err := CheckProvider("openai", opts.APIKey); err != nil {
+		return nil, err
 	}
+	client := openAIClientFor(opts.APIKey)
 
 	if strings.TrimSpace(resource) == "" {
-		return "", fmt.Errorf("resource cannot be empty")
+		return nil, NewError(CodeInvalidRequest, "resource cannot be empty", nil)
 	}
 
 	if strings.TrimSpace(specs) == "" {
-		return "", fmt.Errorf("specs cannot be empty")
+		return nil, NewError(CodeInvalidRequest, "specs cannot be empty", nil)
 	}
 
-	log.Printf("Generating Terraform code for resource: %s with specs: %s", resource, specs)
-
-	prompt := fmt.Sprintf(`
-You are a Terraform expert. Generate Terraform code to provision the following:
+	slog.InfoContext(ctx, "Generating Terraform code", "provider", "openai", "resource", resource)
 
-Resource: %s
-Specs: %s
-
-Only output valid Terraform code inside one block. Do not explain anything.
-`, resource, specs)
+	settings := config.Current()
+	prompt, promptVersion, err := buildPrompt(settings.Prompts, settings.Prompts.OpenAI, openAIPromptTemplate, resource, specs, opts)
+	if err != nil {
+		return nil, err
+	}
 
+	provider := settings.Providers.OpenAI
 	req := openai.ChatCompletionRequest{
-		Model: openai.GPT3Dot5Turbo,
+		Model: provider.Model,
 		Messages: []openai.ChatCompletionMessage{
 			{
 				Role:    openai.ChatMessageRoleUser,
 				Content: prompt,
 			},
 		},
-		Temperature: 0.2,
-		MaxTokens:   2000, // Limit response size
+		Temperature: provider.Temperature,
+		MaxTokens:   provider.MaxTokens, // Limit response size
 	}
+	slog.DebugContext(ctx, "Provider prompt", "provider", "openai", "model", req.Model, "prompt_chars", len(prompt), "prompt_sha256", textDigest(prompt))
 
 	// Create context with timeout for the API call
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, provider.Timeout.Std())
 	defer cancel()
 
-	resp, err := openaiClient.CreateChatCompletion(ctx, req)
+	ctx, span := startProviderSpan(ctx, "openai", req.Model)
+	start := time.Now()
+	defer func() {
+		observeGeneration("openai", req.Model, start, out, err)
+		endProviderSpan(span, out, err)
+	}()
+
+	resp, err := client.CreateChatCompletion(ctx, req)
 	if err != nil {
-		log.Printf("Error calling OpenAI API: %v", err)
-		return "", fmt.Errorf("failed to generate terraform code: %w", err)
+		slog.WarnContext(ctx, "OpenAI API call failed", "error", err)
+		return nil, classifyOpenAIError(err)
 	}
 
 	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response choices from OpenAI API")
+		return nil, NewRetryableError(CodeEmptyOutput, "no response choices from OpenAI API", nil)
 	}
 
 	content := resp.Choices[0].Message.Content
 	if strings.TrimSpace(content) == "" {
-		return "", fmt.Errorf("OpenAI returned empty content")
+		return nil, NewRetryableError(CodeEmptyOutput, "OpenAI returned empty content", nil)
 	}
 
-	log.Printf("Successfully generated Terraform code (%d characters)", len(content))
-	return content, nil
+	slog.InfoContext(ctx, "Generated Terraform code", "provider", "openai", "model", resp.Model,
+		"chars", len(content), "total_tokens", resp.Usage.TotalTokens)
+	slog.DebugContext(ctx, "Provider response", "provider", "openai", "content_chars", len(content), "content_sha256", textDigest(content))
+	return &GenerationOutput{
+		Content: content,
+		Model:   resp.Model,
+		Usage: TokenUsage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+		PromptVersion: promptVersion,
+	}, nil
 }
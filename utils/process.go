@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// processWaitDelay bounds how long a cancelled command may keep its output pipes open
+const processWaitDelay = 5 * time.Second
+
+// commandContext creates a command that is killed, together with any processes it started
+// (such as terraform provider plugins), when ctx is cancelled
+func commandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = processWaitDelay
+	configureProcessGroup(cmd)
+	return cmd
+}
+
+var (
+	tempDirsMu sync.Mutex
+	tempDirs   = map[string]struct{}{}
+)
+
+// trackTempDir records a working directory until cleanupTempDir removes it
+func trackTempDir(dir string) {
+	tempDirsMu.Lock()
+	tempDirs[dir] = struct{}{}
+	tempDirsMu.Unlock()
+}
+
+// CleanupTempDirs removes working directories left behind by validations that did not finish,
+// e.g. during a forced shutdown
+func CleanupTempDirs() int {
+	tempDirsMu.Lock()
+	defer tempDirsMu.Unlock()
+
+	removed := 0
+	for dir := range tempDirs {
+		if err := os.RemoveAll(dir); err != nil {
+			slog.Warn("Failed to clean up temporary directory", "dir", dir, "error", err)
+			continue
+		}
+		delete(tempDirs, dir)
+		removed++
+	}
+	return removed
+}
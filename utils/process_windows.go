@@ -0,0 +1,8 @@
+//go:build windows
+
+package utils
+
+import "os/exec"
+
+// configureProcessGroup keeps the default behaviour on Windows, where cancelling kills only the command itself
+func configureProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"devops-autopilot/config"
+)
+
+// ProviderNames lists the LLM providers in the order they are reported
+var ProviderNames = []string{"openai", "copilot"}
+
+// providerDisplayNames are used in messages
+var providerDisplayNames = map[string]string{
+	"openai":  "OpenAI",
+	"copilot": "GitHub Copilot",
+}
+
+// modelListTTL is how long a provider's model list is reused
+const modelListTTL = 10 * time.Minute
+
+// ProviderStatus reports whether an LLM provider can serve generations
+type ProviderStatus struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"` // why the provider is disabled
+	Model   string `json:"model"`            // model used for generations
+}
+
+// GetProviderStatus reports a provider's status from the current configuration. credential is a
+// tenant's own key or token, used instead of the service-wide one when set. A provider is enabled
+// when it is not turned off in the configuration and has a credential.
+func GetProviderStatus(name, credential string) ProviderStatus {
+	settings, known := config.Current().Providers.Get(name)
+	status := ProviderStatus{Name: name, Model: settings.Model}
+	switch {
+	case !known:
+		status.Reason = "unknown provider"
+	case settings.Disabled:
+		status.Reason = fmt.Sprintf("disabled by configuration (providers.%s.disabled)", name)
+	case credential == "" && serviceCredential(name) == "":
+		if name == "openai" {
+			status.Reason = "no API key configured (OPENAI_API_KEY or providers.openai.api_key)"
+		} else {
+			status.Reason = "no GitHub token configured (GITHUB_TOKEN or github.token)"
+		}
+	default:
+		status.Enabled = true
+	}
+	return status
+}
+
+// ProviderStatuses reports the status of every provider with the service-wide credentials
+func ProviderStatuses() []ProviderStatus {
+	statuses := make([]ProviderStatus, 0, len(ProviderNames))
+	for _, name := range ProviderNames {
+		statuses = append(statuses, GetProviderStatus(name, ""))
+	}
+	return statuses
+}
+
+// CheckProvider returns a typed error explaining why a provider cannot serve a generation, or nil
+func CheckProvider(name, credential string) *Error {
+	status := GetProviderStatus(name, credential)
+	if status.Enabled {
+		return nil
+	}
+	code := CodeProviderNotConfigured
+	if settings, _ := config.Current().Providers.Get(name); settings.Disabled {
+		code = CodeProviderDisabled
+	}
+	return NewError(code, fmt.Sprintf("%s is not available: %s", providerDisplayName(name), status.Reason), nil)
+}
+
+// InitProviders logs whether each provider is enabled. A provider without credentials is disabled
+// rather than stopping the server, and is enabled once credentials are configured and reloaded.
+func InitProviders() {
+	for _, status := range ProviderStatuses() {
+		if status.Enabled {
+			slog.Info("Provider enabled", "provider", status.Name, "model", status.Model)
+		} else {
+			slog.Warn("Provider disabled", "provider", status.Name, "reason", status.Reason)
+		}
+	}
+}
+
+// serviceCredential returns the service-wide credential for a provider
+func serviceCredential(name string) string {
+	settings := config.Current()
+	switch name {
+	case "openai":
+		return settings.Providers.OpenAI.APIKey
+	case "copilot":
+		return settings.GitHub.Token
+	default:
+		return ""
+	}
+}
+
+// providerDisplayName returns a provider's name for messages
+func providerDisplayName(name string) string {
+	if display, ok := providerDisplayNames[name]; ok {
+		return display
+	}
+	return name
+}
+
+// modelList is a cached list of a provider's models
+type modelList struct {
+	models  []string
+	fetched time.Time
+}
+
+var (
+	modelListsMu sync.Mutex
+	modelLists   = map[string]modelList{}
+)
+
+// credentialKey identifies a credential in caches without keeping the credential itself as a key
+func credentialKey(credential string) string {
+	sum := sha256.Sum256([]byte(credential))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ListModels returns the chat models a provider offers to the given credential (or the
+// service-wide one), sorted by name. Lists are cached so the endpoint does not spend provider
+// rate limits.
+func ListModels(ctx context.Context, name, credential string) ([]string, error) {
+	if err := CheckProvider(name, credential); err != nil {
+		return nil, err
+	}
+	if credential == "" {
+		credential = serviceCredential(name)
+	}
+
+	key := name + ":" + credentialKey(credential)
+	modelListsMu.Lock()
+	cached, found := modelLists[key]
+	modelListsMu.Unlock()
+	if found && time.Since(cached.fetched) < modelListTTL {
+		return cached.models, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var models []string
+	var err error
+	if name == "openai" {
+		models, err = listOpenAIModels(ctx, openAIClientFor(credential))
+	} else {
+		models, err = listGitHubModels(ctx, credential)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(models)
+
+	modelListsMu.Lock()
+	modelLists[key] = modelList{models: models, fetched: time.Now()}
+	modelListsMu.Unlock()
+	return models, nil
+}
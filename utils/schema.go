@@ -0,0 +1,687 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"devops-autopilot/config"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// maxPromptSchemaTypes caps how many resource schemas are added to a prompt
+const maxPromptSchemaTypes = 3
+
+// maxPromptSchemaAttributes caps the optional attributes listed per resource in a prompt
+const maxPromptSchemaAttributes = 40
+
+// SchemaBlock is a block schema from terraform providers schema -json
+type SchemaBlock struct {
+	Attributes map[string]*SchemaAttribute   `json:"attributes"`
+	BlockTypes map[string]*SchemaNestedBlock `json:"block_types"`
+}
+
+// SchemaAttribute is an attribute schema from terraform providers schema -json
+type SchemaAttribute struct {
+	Type       json.RawMessage `json:"type"`
+	NestedType json.RawMessage `json:"nested_type"`
+	Required   bool            `json:"required"`
+	Optional   bool            `json:"optional"`
+	Computed   bool            `json:"computed"`
+	Deprecated bool            `json:"deprecated"`
+}
+
+// SchemaNestedBlock is a nested block schema from terraform providers schema -json
+type SchemaNestedBlock struct {
+	NestingMode string       `json:"nesting_mode"`
+	Block       *SchemaBlock `json:"block"`
+}
+
+// SchemaResource is a resource or data source schema
+type SchemaResource struct {
+	Block *SchemaBlock `json:"block"`
+}
+
+// ProviderSchema holds the schema of a single provider version
+type ProviderSchema struct {
+	Source            string                     `json:"source"`
+	Version           string                     `json:"version"`
+	ResourceSchemas   map[string]*SchemaResource `json:"resource_schemas"`
+	DataSourceSchemas map[string]*SchemaResource `json:"data_source_schemas"`
+}
+
+// SchemaFinding represents a schema violation found in terraform code
+type SchemaFinding struct {
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+	Line       int    `json:"line"`
+}
+
+// providersSchemaOutput represents the JSON output from terraform providers schema -json
+type providersSchemaOutput struct {
+	ProviderSchemas map[string]*ProviderSchema `json:"provider_schemas"`
+}
+
+var (
+	schemaCacheMu       sync.RWMutex
+	schemaCache         = map[string]*ProviderSchema{} // keyed by source@version
+	schemaDiskLoaded    sync.Once
+	schemaFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+	promptWordPattern   = regexp.MustCompile(`[a-z0-9]+`)
+)
+
+// metaArguments are accepted on every resource and data block
+var metaArguments = map[string]bool{
+	"count":      true,
+	"for_each":   true,
+	"provider":   true,
+	"depends_on": true,
+}
+
+// metaBlocks are accepted on every resource block and are not part of the provider schema
+var metaBlocks = map[string]bool{
+	"lifecycle":   true,
+	"connection":  true,
+	"provisioner": true,
+}
+
+// schemaCacheDir returns the directory where provider schemas are cached on disk
+func schemaCacheDir() string {
+	return config.Current().Terraform.SchemaCacheDir
+}
+
+// schemaCacheFile returns the on-disk cache path for a provider version
+func schemaCacheFile(source, version string) string {
+	name := schemaFileNameChars.ReplaceAllString(source, "_")
+	return filepath.Join(schemaCacheDir(), fmt.Sprintf("%s_%s.json", name, version))
+}
+
+// readLockedProviders returns provider source to version from an initialized directory's lock file
+func readLockedProviders(dir string) (map[string]string, error) {
+	src, err := os.ReadFile(filepath.Join(dir, ".terraform.lock.hcl"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+
+	file, diags := hclsyntax.ParseConfig(src, ".terraform.lock.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse lock file: %s", diags.Error())
+	}
+
+	providers := map[string]string{}
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if block.Type != "provider" || len(block.Labels) != 1 {
+			continue
+		}
+		attr, ok := block.Body.Attributes["version"]
+		if !ok {
+			continue
+		}
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() || value.Type().FriendlyName() != "string" {
+			continue
+		}
+		providers[block.Labels[0]] = value.AsString()
+	}
+
+	return providers, nil
+}
+
+// cachedProviderSchema returns a schema from memory or disk
+func cachedProviderSchema(source, version string) *ProviderSchema {
+	key := source + "@" + version
+
+	schemaCacheMu.RLock()
+	schema, ok := schemaCache[key]
+	schemaCacheMu.RUnlock()
+	if ok {
+		return schema
+	}
+
+	data, err := os.ReadFile(schemaCacheFile(source, version))
+	if err != nil {
+		return nil
+	}
+	schema = &ProviderSchema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil
+	}
+
+	schemaCacheMu.Lock()
+	schemaCache[key] = schema
+	schemaCacheMu.Unlock()
+	return schema
+}
+
+// storeProviderSchema caches a schema in memory and on disk
+func storeProviderSchema(schema *ProviderSchema) {
+	schemaCacheMu.Lock()
+	schemaCache[schema.Source+"@"+schema.Version] = schema
+	schemaCacheMu.Unlock()
+
+	if err := os.MkdirAll(schemaCacheDir(), 0755); err != nil {
+		slog.Warn("Failed to create schema cache directory", "error", err)
+		return
+	}
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(schemaCacheFile(schema.Source, schema.Version), data, 0644); err != nil {
+		slog.Warn("Failed to write schema cache", "error", err)
+	}
+}
+
+// loadProviderSchemas returns schemas for every provider locked in an initialized directory
+func loadProviderSchemas(ctx context.Context, dir string) (map[string]*ProviderSchema, error) {
+	locked, err := readLockedProviders(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas := map[string]*ProviderSchema{}
+	missing := false
+	for source, version := range locked {
+		if schema := cachedProviderSchema(source, version); schema != nil {
+			schemas[source] = schema
+		} else {
+			missing = true
+		}
+	}
+	if !missing {
+		return schemas, nil
+	}
+
+	// One terraform call returns every provider in the directory
+	cmd := commandContext(ctx, "terraform", "providers", "schema", "-json")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return schemas, fmt.Errorf("terraform providers schema failed: %w", err)
+	}
+
+	var parsed providersSchemaOutput
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		return schemas, fmt.Errorf("failed to parse provider schemas: %w", err)
+	}
+
+	for source, schema := range parsed.ProviderSchemas {
+		version, ok := locked[source]
+		if !ok {
+			continue
+		}
+		schema.Source = source
+		schema.Version = version
+		storeProviderSchema(schema)
+		schemas[source] = schema
+	}
+
+	return schemas, nil
+}
+
+// WarmProviderSchemas loads and caches schemas for the given providers (e.g. "hashicorp/aws")
+func WarmProviderSchemas(sources []string) error {
+	if !isTerraformInstalled() {
+		return fmt.Errorf("terraform CLI is not installed")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("terraform {\n  required_providers {\n")
+	for i, source := range sources {
+		sb.WriteString(fmt.Sprintf("    p%d = { source = %q }\n", i, strings.TrimSpace(source)))
+	}
+	sb.WriteString("  }\n}\n")
+
+	tempDir, err := createTempTerraformDir(sb.String())
+	if err != nil {
+		return err
+	}
+	defer cleanupTempDir(tempDir)
+
+	ctx := context.Background()
+	if output, err := runTerraformInit(ctx, tempDir); err != nil {
+		return fmt.Errorf("%w: %s", err, output)
+	}
+
+	_, err = loadProviderSchemas(ctx, tempDir)
+	return err
+}
+
+// CheckTerraformSchema validates resource types and arguments against provider schemas
+func CheckTerraformSchema(terraformCode string, schemas map[string]*ProviderSchema) []SchemaFinding {
+	file, diags := hclsyntax.ParseConfig([]byte(terraformCode), "main.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil
+	}
+
+	var findings []SchemaFinding
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if (block.Type != "resource" && block.Type != "data") || len(block.Labels) != 2 {
+			continue
+		}
+
+		typeName := block.Labels[0]
+		schema := schemaForType(typeName, schemas)
+		if schema == nil {
+			continue
+		}
+
+		kind, available := "resource", schema.ResourceSchemas
+		if block.Type == "data" {
+			kind, available = "data source", schema.DataSourceSchemas
+		}
+
+		resourceSchema, ok := available[typeName]
+		if !ok {
+			finding := SchemaFinding{
+				Severity:   "error",
+				Message:    fmt.Sprintf("Unknown %s type %q for provider %s", kind, typeName, schema.Source),
+				Suggestion: nameSuggestion(typeName, sortedKeys(available)),
+				Line:       block.TypeRange.Start.Line,
+			}
+			findings = append(findings, withSuggestion(finding))
+			continue
+		}
+
+		address := fmt.Sprintf("%s.%s", typeName, block.Labels[1])
+		findings = append(findings, checkBlockBody(block.Body, resourceSchema.Block, address, true)...)
+	}
+
+	return findings
+}
+
+// checkBlockBody validates the attributes and nested blocks of a block body
+func checkBlockBody(body *hclsyntax.Body, schema *SchemaBlock, address string, topLevel bool) []SchemaFinding {
+	if schema == nil {
+		return nil
+	}
+
+	var findings []SchemaFinding
+	for name, attr := range body.Attributes {
+		if topLevel && metaArguments[name] {
+			continue
+		}
+		if schemaAttr, ok := schema.Attributes[name]; ok {
+			if schemaAttr.Deprecated {
+				findings = append(findings, SchemaFinding{
+					Severity: "warning",
+					Message:  fmt.Sprintf("Argument %q in %s is deprecated", name, address),
+					Line:     attr.SrcRange.Start.Line,
+				})
+			}
+			continue
+		}
+		findings = append(findings, withSuggestion(SchemaFinding{
+			Severity:   "error",
+			Message:    fmt.Sprintf("Unsupported argument %q in %s", name, address),
+			Suggestion: nameSuggestion(name, schemaNames(schema)),
+			Line:       attr.SrcRange.Start.Line,
+		}))
+	}
+
+	for _, block := range body.Blocks {
+		name := block.Type
+		if topLevel && metaBlocks[name] {
+			continue
+		}
+		if name == "dynamic" && len(block.Labels) == 1 {
+			name = block.Labels[0]
+		}
+
+		if nested, ok := schema.BlockTypes[name]; ok {
+			if block.Type == "dynamic" {
+				for _, content := range block.Body.Blocks {
+					if content.Type == "content" {
+						findings = append(findings, checkBlockBody(content.Body, nested.Block, address+"."+name, false)...)
+					}
+				}
+				continue
+			}
+			findings = append(findings, checkBlockBody(block.Body, nested.Block, address+"."+name, false)...)
+			continue
+		}
+
+		// Some list-of-object attributes may be written in block syntax (e.g. security group ingress)
+		if _, ok := schema.Attributes[name]; ok {
+			continue
+		}
+
+		findings = append(findings, withSuggestion(SchemaFinding{
+			Severity:   "error",
+			Message:    fmt.Sprintf("Unsupported block type %q in %s", name, address),
+			Suggestion: nameSuggestion(name, schemaNames(schema)),
+			Line:       block.TypeRange.Start.Line,
+		}))
+	}
+
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	return findings
+}
+
+// withSuggestion appends a "did you mean" hint to the message when a suggestion exists
+func withSuggestion(finding SchemaFinding) SchemaFinding {
+	if finding.Suggestion != "" {
+		finding.Message = fmt.Sprintf("%s; did you mean %q?", finding.Message, finding.Suggestion)
+	}
+	return finding
+}
+
+// nameSuggestion returns the closest known name within a small edit distance, or ""
+func nameSuggestion(given string, names []string) string {
+	best, bestDistance := "", 3
+	for _, name := range names {
+		if distance := levenshtein(given, name); distance < bestDistance {
+			best, bestDistance = name, distance
+		}
+	}
+	return best
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// min3 returns the smallest of three ints
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// schemaForType finds the provider schema responsible for a resource type by its name prefix.
+// When several sources match, such as hashicorp/google and a fork, the hashicorp/ source wins,
+// then the first in sorted order, so the choice does not depend on map iteration.
+func schemaForType(typeName string, schemas map[string]*ProviderSchema) *ProviderSchema {
+	sources := make([]string, 0, len(schemas))
+	for source := range schemas {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	var match *ProviderSchema
+	for _, source := range sources {
+		name := source[strings.LastIndex(source, "/")+1:]
+		if typeName != name && !strings.HasPrefix(typeName, name+"_") {
+			continue
+		}
+		if source == "hashicorp/"+name || strings.HasSuffix(source, "/hashicorp/"+name) {
+			return schemas[source]
+		}
+		if match == nil {
+			match = schemas[source]
+		}
+	}
+	return match
+}
+
+// schemaNames returns all attribute and block type names of a block schema
+func schemaNames(schema *SchemaBlock) []string {
+	names := make([]string, 0, len(schema.Attributes)+len(schema.BlockTypes))
+	for name := range schema.Attributes {
+		names = append(names, name)
+	}
+	for name := range schema.BlockTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedKeys returns the keys of a schema map in sorted order
+func sortedKeys(m map[string]*SchemaResource) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// promptSynonyms maps common words in requests to words used in resource type names
+var promptSynonyms = map[string][]string{
+	"ec2":      {"instance"},
+	"vm":       {"instance", "virtual", "machine"},
+	"server":   {"instance"},
+	"s3":       {"s3", "bucket"},
+	"rds":      {"db", "instance"},
+	"database": {"db", "instance"},
+	"postgres": {"db", "instance"},
+	"mysql":    {"db", "instance"},
+	"network":  {"vpc", "network"},
+	"firewall": {"security", "group", "firewall"},
+	"sg":       {"security", "group"},
+	"lambda":   {"lambda", "function"},
+	"k8s":      {"eks", "cluster", "kubernetes"},
+	"queue":    {"sqs", "queue"},
+	"topic":    {"sns", "topic"},
+}
+
+// SchemaPromptContext returns schema excerpts for the resource types most relevant to a request
+func SchemaPromptContext(resource, specs string) string {
+	words := map[string]bool{}
+	for _, word := range promptWordPattern.FindAllString(strings.ToLower(resource+" "+specs), -1) {
+		words[word] = true
+		for _, synonym := range promptSynonyms[word] {
+			words[synonym] = true
+		}
+	}
+
+	type candidate struct {
+		schema   *ProviderSchema
+		typeName string
+		score    int
+	}
+	var candidates []candidate
+
+	for _, schema := range latestCachedSchemas() {
+		prefix := schema.Source[strings.LastIndex(schema.Source, "/")+1:] + "_"
+		for typeName := range schema.ResourceSchemas {
+			parts := strings.Split(strings.TrimPrefix(typeName, prefix), "_")
+			score := 0
+			for _, part := range parts {
+				if words[part] {
+					score++
+				}
+			}
+			// Every part of the type name must be mentioned, so "instance" alone does not pull in every *_instance
+			if score > 0 && score == len(parts) {
+				candidates = append(candidates, candidate{schema, typeName, score})
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].typeName < candidates[j].typeName
+	})
+	if len(candidates) > maxPromptSchemaTypes {
+		candidates = candidates[:maxPromptSchemaTypes]
+	}
+
+	var sb strings.Builder
+	for _, c := range candidates {
+		sb.WriteString(fmt.Sprintf("resource %q (%s %s):\n", c.typeName, c.schema.Source, c.schema.Version))
+		sb.WriteString(describeSchemaBlock(c.schema.ResourceSchemas[c.typeName].Block))
+	}
+	return sb.String()
+}
+
+// schemaPromptSection wraps schema excerpts into a prompt section, or returns "" when there are none
+func schemaPromptSection(schemaContext string) string {
+	if strings.TrimSpace(schemaContext) == "" {
+		return ""
+	}
+	return fmt.Sprintf(`
+Use only resource types and arguments that exist in the provider schema. Relevant schema excerpts:
+
+%s`, schemaContext)
+}
+
+// describeSchemaBlock renders a compact, prompt-friendly summary of a block schema
+func describeSchemaBlock(block *SchemaBlock) string {
+	if block == nil {
+		return ""
+	}
+
+	var required, optional, blocks []string
+	for name, attr := range block.Attributes {
+		entry := fmt.Sprintf("%s (%s)", name, schemaTypeString(attr.Type))
+		switch {
+		case attr.Required:
+			required = append(required, entry)
+		case attr.Optional && !attr.Deprecated:
+			optional = append(optional, entry)
+		}
+	}
+	for name := range block.BlockTypes {
+		blocks = append(blocks, name)
+	}
+	sort.Strings(required)
+	sort.Strings(optional)
+	sort.Strings(blocks)
+	if len(optional) > maxPromptSchemaAttributes {
+		optional = optional[:maxPromptSchemaAttributes]
+	}
+
+	var sb strings.Builder
+	if len(required) > 0 {
+		sb.WriteString("  required: " + strings.Join(required, ", ") + "\n")
+	}
+	if len(optional) > 0 {
+		sb.WriteString("  optional: " + strings.Join(optional, ", ") + "\n")
+	}
+	if len(blocks) > 0 {
+		sb.WriteString("  blocks: " + strings.Join(blocks, ", ") + "\n")
+	}
+	return sb.String()
+}
+
+// schemaTypeString renders a cty JSON type such as ["list","string"] as list(string)
+func schemaTypeString(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return "object"
+	}
+
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return name
+	}
+
+	var parts []json.RawMessage
+	if err := json.Unmarshal(raw, &parts); err != nil || len(parts) == 0 {
+		return "any"
+	}
+	var kind string
+	if err := json.Unmarshal(parts[0], &kind); err != nil {
+		return "any"
+	}
+	if kind == "object" || len(parts) < 2 {
+		return kind
+	}
+	return fmt.Sprintf("%s(%s)", kind, schemaTypeString(parts[1]))
+}
+
+// latestCachedSchemas returns the newest cached schema of each provider, loading the disk cache on first use
+func latestCachedSchemas() []*ProviderSchema {
+	schemaDiskLoaded.Do(loadSchemaDiskCache)
+
+	schemaCacheMu.RLock()
+	defer schemaCacheMu.RUnlock()
+
+	latest := map[string]*ProviderSchema{}
+	for _, schema := range schemaCache {
+		current, ok := latest[schema.Source]
+		if !ok || compareVersions(schema.Version, current.Version) > 0 {
+			latest[schema.Source] = schema
+		}
+	}
+
+	result := make([]*ProviderSchema, 0, len(latest))
+	for _, schema := range latest {
+		result = append(result, schema)
+	}
+	return result
+}
+
+// loadSchemaDiskCache loads every schema in the disk cache into memory
+func loadSchemaDiskCache() {
+	entries, err := os.ReadDir(schemaCacheDir())
+	if err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(schemaCacheDir(), entry.Name()))
+			if err != nil {
+				continue
+			}
+			schema := &ProviderSchema{}
+			if json.Unmarshal(data, schema) != nil || schema.Source == "" {
+				continue
+			}
+			schemaCacheMu.Lock()
+			if _, ok := schemaCache[schema.Source+"@"+schema.Version]; !ok {
+				schemaCache[schema.Source+"@"+schema.Version] = schema
+			}
+			schemaCacheMu.Unlock()
+		}
+	}
+}
+
+// compareVersions compares dotted numeric versions, returning -1, 0 or 1
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			fmt.Sscanf(as[i], "%d", &x)
+		}
+		if i < len(bs) {
+			fmt.Sscanf(bs[i], "%d", &y)
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
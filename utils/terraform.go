@@ -1,14 +1,23 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
+
+	"devops-autopilot/metrics"
+	"devops-autopilot/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // TerraformValidationResult holds the result of terraform validation
@@ -18,10 +27,29 @@ type TerraformValidationResult struct {
 	Warnings []string `json:"warnings,omitempty"`
 	Output   string   `json:"output,omitempty"`
 	ExecTime int64    `json:"execTime"` // milliseconds
+
+	Lint           *TFLintResult   `json:"lint,omitempty"`
+	SchemaFindings []SchemaFinding `json:"schemaFindings,omitempty"`
+}
+
+// ValidationOptions controls the optional stages of terraform validation
+type ValidationOptions struct {
+	Lint        bool   // run tflint after terraform validate
+	LintRuleset string // named tflint config; empty selects the default ruleset
 }
 
 // ValidateTerraformCode validates terraform code using local terraform CLI
-func ValidateTerraformCode(terraformCode string) (*TerraformValidationResult, error) {
+func ValidateTerraformCode(ctx context.Context, terraformCode string) (*TerraformValidationResult, error) {
+	return ValidateTerraformCodeWithOptions(ctx, terraformCode, ValidationOptions{})
+}
+
+// ValidateTerraformCodeWithOptions validates terraform code and runs the optional stages selected in opts
+func ValidateTerraformCodeWithOptions(ctx context.Context, terraformCode string, opts ValidationOptions) (*TerraformValidationResult, error) {
+	return ValidateTerraformFiles(ctx, map[string]string{"main.tf": terraformCode}, opts)
+}
+
+// ValidateTerraformFiles validates a module made of several files (file name to content)
+func ValidateTerraformFiles(ctx context.Context, files map[string]string, opts ValidationOptions) (*TerraformValidationResult, error) {
 	startTime := time.Now()
 
 	// Check if terraform CLI is available
@@ -34,14 +62,14 @@ func ValidateTerraformCode(terraformCode string) (*TerraformValidationResult, er
 	}
 
 	// Create temporary directory for validation
-	tempDir, err := createTempTerraformDir(terraformCode)
+	tempDir, err := createTempTerraformModule(files)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+		return nil, NewError(CodeTerraformFailed, "failed to create temporary directory", err)
 	}
 	defer cleanupTempDir(tempDir)
 
 	// Run terraform init (required before validate)
-	initResult, err := runTerraformInit(tempDir)
+	initResult, err := runTerraformInit(ctx, tempDir)
 	if err != nil {
 		return &TerraformValidationResult{
 			IsValid:  false,
@@ -52,25 +80,64 @@ func ValidateTerraformCode(terraformCode string) (*TerraformValidationResult, er
 	}
 
 	// Run terraform validate
-	validateResult, err := runTerraformValidate(tempDir)
-	execTime := time.Since(startTime).Milliseconds()
+	validateResult, err := runTerraformValidate(ctx, tempDir)
+	if err != nil && !isValidationFailure(err) {
+		// terraform itself failed (crash, signal, missing binary) rather than reporting invalid code
+		return nil, NewError(CodeTerraformFailed, "terraform validate did not complete",
+			fmt.Errorf("%w: %s", err, strings.TrimSpace(validateResult)))
+	}
 
+	result := &TerraformValidationResult{
+		IsValid: err == nil,
+		Output:  validateResult,
+	}
 	if err != nil {
 		// Parse terraform validation errors from the actual output
-		errors := parseTerraformErrors(validateResult)
-		return &TerraformValidationResult{
-			IsValid:  false,
-			Errors:   errors,
-			Output:   validateResult,
-			ExecTime: execTime,
-		}, nil
+		result.Errors = parseTerraformErrors(validateResult)
+	}
+
+	// Check resource types and arguments against the locked provider schemas
+	schemas, err := loadProviderSchemas(ctx, tempDir)
+	if err != nil {
+		slog.WarnContext(ctx, "Provider schema check skipped", "error", err)
+	}
+	validatePassed := result.IsValid
+	for _, name := range sortedFileNames(files) {
+		if !strings.HasSuffix(name, ".tf") {
+			continue
+		}
+		findings := CheckTerraformSchema(files[name], schemas)
+		result.SchemaFindings = append(result.SchemaFindings, findings...)
+
+		// terraform validate checks the same schemas, so when it failed its errors already cover
+		// these findings. When it passed, an error-severity finding is a defect it did not report,
+		// and it still fails validation.
+		if !validatePassed {
+			continue
+		}
+		for _, finding := range findings {
+			if finding.Severity == "error" {
+				result.IsValid = false
+				result.Errors = append(result.Errors, fmt.Sprintf("%s line %d: %s", name, finding.Line, finding.Message))
+			}
+		}
+	}
+
+	// Run tflint on the same initialized module
+	if opts.Lint {
+		result.Lint = runTFLint(ctx, tempDir, opts.LintRuleset)
+
+		// Error-severity findings fail validation alongside terraform's own diagnostics
+		for _, issue := range result.Lint.Issues {
+			if issue.Severity == "error" {
+				result.IsValid = false
+				result.Errors = append(result.Errors, fmt.Sprintf("Line %d: %s - %s", issue.Line, issue.Rule, issue.Message))
+			}
+		}
 	}
 
-	return &TerraformValidationResult{
-		IsValid:  true,
-		Output:   validateResult,
-		ExecTime: execTime,
-	}, nil
+	result.ExecTime = time.Since(startTime).Milliseconds()
+	return result, nil
 }
 
 // isTerraformInstalled checks if terraform CLI is available
@@ -81,29 +148,48 @@ func isTerraformInstalled() bool {
 
 // createTempTerraformDir creates a temporary directory with the terraform code
 func createTempTerraformDir(terraformCode string) (string, error) {
+	return createTempTerraformModule(map[string]string{"main.tf": terraformCode})
+}
+
+// createTempTerraformModule creates a temporary directory containing the given files
+func createTempTerraformModule(files map[string]string) (string, error) {
 	// Create temporary directory
 	tempDir, err := ioutil.TempDir("", "terraform_validate_*")
 	if err != nil {
 		return "", fmt.Errorf("failed to create temp dir: %w", err)
 	}
 
-	// Write terraform code to main.tf
-	mainTfPath := filepath.Join(tempDir, "main.tf")
-	err = ioutil.WriteFile(mainTfPath, []byte(terraformCode), 0644)
-	if err != nil {
-		os.RemoveAll(tempDir)
-		return "", fmt.Errorf("failed to write terraform file: %w", err)
+	// Write each file into the module directory
+	for name, content := range files {
+		if name != filepath.Base(name) {
+			os.RemoveAll(tempDir)
+			return "", fmt.Errorf("invalid file name %q", name)
+		}
+		err = ioutil.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644)
+		if err != nil {
+			os.RemoveAll(tempDir)
+			return "", fmt.Errorf("failed to write terraform file: %w", err)
+		}
 	}
 
+	trackTempDir(tempDir)
 	return tempDir, nil
 }
 
 // runTerraformInit runs terraform init in the given directory
-func runTerraformInit(dir string) (string, error) {
-	cmd := exec.Command("terraform", "init", "-no-color")
+func runTerraformInit(ctx context.Context, dir string) (string, error) {
+	cmd := commandContext(ctx, "terraform", "init", "-no-color")
 	cmd.Dir = dir
+	// Providers are reused from the plugin cache instead of downloaded for every validation
+	if cacheDir := PluginCacheDir(); cacheDir != "" {
+		cmd.Env = append(os.Environ(), "TF_PLUGIN_CACHE_DIR="+cacheDir)
+	}
 
+	_, span := tracing.Start(ctx, "terraform.init")
+	start := time.Now()
 	output, err := cmd.CombinedOutput()
+	metrics.ObserveTerraform("init", time.Since(start), err)
+	tracing.End(span, err)
 	outputStr := string(output)
 
 	if err != nil {
@@ -114,11 +200,21 @@ func runTerraformInit(dir string) (string, error) {
 }
 
 // runTerraformValidate runs terraform validate in the given directory
-func runTerraformValidate(dir string) (string, error) {
-	cmd := exec.Command("terraform", "validate", "-no-color", "-json")
+func runTerraformValidate(ctx context.Context, dir string) (string, error) {
+	cmd := commandContext(ctx, "terraform", "validate", "-no-color", "-json")
 	cmd.Dir = dir
 
+	_, span := tracing.Start(ctx, "terraform.validate")
+	start := time.Now()
 	output, err := cmd.CombinedOutput()
+	// Exit status 1 reports invalid code; the command itself succeeded
+	commandErr := err
+	if isValidationFailure(err) {
+		commandErr = nil
+	}
+	metrics.ObserveTerraform("validate", time.Since(start), commandErr)
+	span.SetAttributes(attribute.Bool("terraform.valid", err == nil))
+	tracing.End(span, commandErr)
 	outputStr := string(output)
 
 	if err != nil {
@@ -128,6 +224,12 @@ func runTerraformValidate(dir string) (string, error) {
 	return outputStr, nil
 }
 
+// isValidationFailure reports whether terraform exited with status 1, which it uses for invalid configuration
+func isValidationFailure(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == 1
+}
+
 // parseTerraformErrors extracts error messages from terraform output
 func parseTerraformErrors(output string) []string {
 	var errors []string
@@ -207,10 +309,25 @@ func parseJSONErrors(jsonOutput string) []string {
 	return errors
 }
 
+// sortedFileNames returns the file names of a module in sorted order
+func sortedFileNames(files map[string]string) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // cleanupTempDir removes the temporary directory
 func cleanupTempDir(dir string) {
 	if err := os.RemoveAll(dir); err != nil {
 		// Log error but don't fail the operation
-		fmt.Printf("Warning: failed to cleanup temp dir %s: %v\n", dir, err)
+		slog.Warn("Failed to clean up temporary directory", "dir", dir, "error", err)
+		return
 	}
+
+	tempDirsMu.Lock()
+	delete(tempDirs, dir)
+	tempDirsMu.Unlock()
 }
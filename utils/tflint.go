@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"devops-autopilot/config"
+)
+
+// lintRulesetNamePattern restricts ruleset names so they cannot escape the config directory
+var lintRulesetNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// TFLintIssue represents a single finding reported by tflint
+type TFLintIssue struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Link     string `json:"link,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+// TFLintResult holds the result of a tflint run
+type TFLintResult struct {
+	Ruleset  string        `json:"ruleset"`
+	Issues   []TFLintIssue `json:"issues,omitempty"`
+	Errors   []string      `json:"errors,omitempty"`
+	ExecTime int64         `json:"execTime"` // milliseconds
+}
+
+// tflintOutput represents the JSON output from tflint --format=json
+type tflintOutput struct {
+	Issues []struct {
+		Rule struct {
+			Name     string `json:"name"`
+			Severity string `json:"severity"`
+			Link     string `json:"link"`
+		} `json:"rule"`
+		Message string `json:"message"`
+		Range   struct {
+			Filename string `json:"filename"`
+			Start    struct {
+				Line   int `json:"line"`
+				Column int `json:"column"`
+			} `json:"start"`
+		} `json:"range"`
+	} `json:"issues"`
+	Errors []struct {
+		Summary string `json:"summary"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// LintRulesetExists reports whether a named ruleset config is present in the config directory
+func LintRulesetExists(name string) bool {
+	if !lintRulesetNamePattern.MatchString(name) {
+		return false
+	}
+	_, err := os.Stat(lintRulesetPath(name))
+	return err == nil
+}
+
+// lintRulesetPath returns the config file path for a named ruleset
+func lintRulesetPath(name string) string {
+	return filepath.Join(config.Current().Lint.ConfigDir, name+".hcl")
+}
+
+// isTFLintInstalled checks if tflint is available
+func isTFLintInstalled() bool {
+	_, err := exec.LookPath("tflint")
+	return err == nil
+}
+
+// runTFLint runs tflint with the named ruleset against an initialized terraform directory
+func runTFLint(ctx context.Context, dir, ruleset string) *TFLintResult {
+	startTime := time.Now()
+
+	// The default ruleset is set by policy and is used when a request does not select one
+	defaultRuleset := config.Current().Policies.DefaultLintRuleset
+	if ruleset == "" {
+		ruleset = defaultRuleset
+	}
+	result := &TFLintResult{Ruleset: ruleset}
+
+	if !isTFLintInstalled() {
+		result.Errors = []string{"tflint is not installed or not available in PATH"}
+		result.ExecTime = time.Since(startTime).Milliseconds()
+		return result
+	}
+
+	if !lintRulesetNamePattern.MatchString(ruleset) {
+		result.Errors = []string{fmt.Sprintf("invalid lint ruleset name %q", ruleset)}
+		result.ExecTime = time.Since(startTime).Milliseconds()
+		return result
+	}
+
+	args := []string{"--format=json", "--no-color"}
+
+	// The default ruleset is optional; any other named ruleset must exist
+	configPath, err := filepath.Abs(lintRulesetPath(ruleset))
+	if err == nil {
+		if _, statErr := os.Stat(configPath); statErr == nil {
+			args = append(args, "--config="+configPath)
+		} else if ruleset != defaultRuleset {
+			result.Errors = []string{fmt.Sprintf("lint ruleset %q not found", ruleset)}
+			result.ExecTime = time.Since(startTime).Milliseconds()
+			return result
+		}
+	}
+
+	cmd := commandContext(ctx, "tflint", args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+
+	// Plugins are loaded from a local directory so lint never downloads anything
+	if pluginDir := config.Current().Lint.PluginDir; pluginDir != "" {
+		if absPluginDir, err := filepath.Abs(pluginDir); err == nil {
+			cmd.Env = append(cmd.Env, "TFLINT_PLUGIN_DIR="+absPluginDir)
+		}
+	}
+
+	// tflint exits non-zero when it finds issues, so the output is parsed regardless
+	output, runErr := cmd.Output()
+	parseTFLintOutput(output, result)
+
+	if runErr != nil && len(result.Issues) == 0 && len(result.Errors) == 0 {
+		message := runErr.Error()
+		if exitErr, ok := runErr.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			message = strings.TrimSpace(string(exitErr.Stderr))
+		}
+		result.Errors = []string{fmt.Sprintf("tflint failed: %s", message)}
+	}
+
+	result.ExecTime = time.Since(startTime).Milliseconds()
+	return result
+}
+
+// parseTFLintOutput extracts issues and errors from tflint's JSON output
+func parseTFLintOutput(output []byte, result *TFLintResult) {
+	if len(strings.TrimSpace(string(output))) == 0 {
+		return
+	}
+
+	var parsed tflintOutput
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to parse tflint output: %s", string(output)))
+		return
+	}
+
+	for _, issue := range parsed.Issues {
+		result.Issues = append(result.Issues, TFLintIssue{
+			Rule:     issue.Rule.Name,
+			Severity: issue.Rule.Severity,
+			Message:  issue.Message,
+			Link:     issue.Rule.Link,
+			Filename: issue.Range.Filename,
+			Line:     issue.Range.Start.Line,
+			Column:   issue.Range.Start.Column,
+		})
+	}
+
+	for _, lintErr := range parsed.Errors {
+		message := lintErr.Message
+		if lintErr.Summary != "" && !strings.Contains(message, lintErr.Summary) {
+			message = lintErr.Summary + ": " + message
+		}
+		result.Errors = append(result.Errors, message)
+	}
+}
@@ -0,0 +1,256 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// extractableAttributes maps environment-specific attribute names to a description template.
+// %s is replaced with the addresses of the blocks that use the value.
+var extractableAttributes = map[string]string{
+	"region":             "Region for %s",
+	"instance_type":      "Instance type for %s",
+	"availability_zone":  "Availability zone for %s",
+	"availability_zones": "Availability zones for %s",
+	"cidr_block":         "CIDR block for %s",
+	"cidr_blocks":        "CIDR blocks for %s",
+}
+
+// anyAddressCIDRs are not environment-specific and are left as literals
+var anyAddressCIDRs = map[string]bool{
+	"0.0.0.0/0": true,
+	"::/0":      true,
+}
+
+// ExtractedVariable describes a literal that was lifted into an input variable
+type ExtractedVariable struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Default     string   `json:"default"` // HCL literal
+	References  []string `json:"references"`
+}
+
+// VariableExtractionResult holds refactored code and the generated variable files
+type VariableExtractionResult struct {
+	Code          string              `json:"code"`
+	VariablesTF   string              `json:"variablesTf"`
+	TFVarsExample string              `json:"tfvarsExample"`
+	Variables     []ExtractedVariable `json:"variables"`
+}
+
+// literalOccurrence is a single extractable literal found in the code
+type literalOccurrence struct {
+	attrName string
+	label    string // resource name or provider name, used to qualify variable names
+	address  string // e.g. aws_subnet.public or provider.aws
+	value    cty.Value
+	body     *hclwrite.Body
+}
+
+// ExtractVariables lifts hard-coded regions, CIDRs, instance types and availability zones into variables
+func ExtractVariables(terraformCode string) (*VariableExtractionResult, error) {
+	file, diags := hclwrite.ParseConfig([]byte(terraformCode), "main.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse terraform code: %s", diags.Error())
+	}
+
+	// Existing variables are kept and their names are not reused
+	taken := map[string]bool{}
+	var occurrences []literalOccurrence
+	for _, block := range file.Body().Blocks() {
+		labels := block.Labels()
+		switch {
+		case block.Type() == "variable" && len(labels) == 1:
+			taken[labels[0]] = true
+		case (block.Type() == "resource" || block.Type() == "data") && len(labels) == 2:
+			address := labels[0] + "." + labels[1]
+			if block.Type() == "data" {
+				address = "data." + address
+			}
+			occurrences = append(occurrences, findLiterals(block.Body(), labels[1], address)...)
+		case block.Type() == "provider" && len(labels) == 1:
+			occurrences = append(occurrences, findLiterals(block.Body(), labels[0], "provider."+labels[0])...)
+		}
+	}
+
+	result := &VariableExtractionResult{Code: terraformCode}
+	if len(occurrences) == 0 {
+		return result, nil
+	}
+
+	// Distinct values per attribute decide whether names need a qualifier
+	distinct := map[string]map[string]bool{}
+	for _, occ := range occurrences {
+		if distinct[occ.attrName] == nil {
+			distinct[occ.attrName] = map[string]bool{}
+		}
+		distinct[occ.attrName][valueKey(occ.value)] = true
+	}
+
+	variables := map[string]*ExtractedVariable{} // attribute + value -> variable
+	var order []*ExtractedVariable
+	for _, occ := range occurrences {
+		key := occ.attrName + "=" + valueKey(occ.value)
+		variable, ok := variables[key]
+		if !ok {
+			name := occ.attrName
+			if len(distinct[occ.attrName]) > 1 {
+				name = occ.label + "_" + occ.attrName
+			}
+			name = uniqueVariableName(sanitizeIdentifier(name), taken)
+
+			variable = &ExtractedVariable{
+				Name:    name,
+				Type:    "string",
+				Default: strings.TrimSpace(string(hclwrite.TokensForValue(occ.value).Bytes())),
+			}
+			if !occ.value.Type().IsPrimitiveType() {
+				variable.Type = "list(string)"
+			}
+			variables[key] = variable
+			order = append(order, variable)
+		}
+		variable.References = append(variable.References, occ.address+"."+occ.attrName)
+
+		occ.body.SetAttributeTraversal(occ.attrName, hcl.Traversal{
+			hcl.TraverseRoot{Name: "var"},
+			hcl.TraverseAttr{Name: variable.Name},
+		})
+	}
+
+	var variablesTF, tfvars strings.Builder
+	tfvars.WriteString("# Example values; copy to terraform.tfvars and adjust per environment\n")
+	for i, variable := range order {
+		addresses := make([]string, 0, len(variable.References))
+		for _, ref := range variable.References {
+			addresses = append(addresses, ref[:strings.LastIndex(ref, ".")])
+		}
+		attrName := variable.References[0][strings.LastIndex(variable.References[0], ".")+1:]
+		variable.Description = fmt.Sprintf(extractableAttributes[attrName], strings.Join(addresses, ", "))
+
+		if i > 0 {
+			variablesTF.WriteString("\n")
+		}
+		variablesTF.WriteString(fmt.Sprintf("variable %q {\n  description = %q\n  type = %s\n  default = %s\n}\n",
+			variable.Name, variable.Description, variable.Type, variable.Default))
+		tfvars.WriteString(fmt.Sprintf("%s = %s\n", variable.Name, variable.Default))
+
+		result.Variables = append(result.Variables, *variable)
+	}
+
+	result.Code = string(hclwrite.Format(file.Bytes()))
+	result.VariablesTF = string(hclwrite.Format([]byte(variablesTF.String())))
+	result.TFVarsExample = string(hclwrite.Format([]byte(tfvars.String())))
+	return result, nil
+}
+
+// findLiterals walks a block body and its nested blocks for extractable literal attributes
+func findLiterals(body *hclwrite.Body, label, address string) []literalOccurrence {
+	var found []literalOccurrence
+
+	names := make([]string, 0, len(body.Attributes()))
+	for name := range body.Attributes() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := extractableAttributes[name]; !ok {
+			continue
+		}
+		value, ok := literalValue(body.Attributes()[name])
+		if !ok {
+			continue
+		}
+		found = append(found, literalOccurrence{
+			attrName: name,
+			label:    label,
+			address:  address,
+			value:    value,
+			body:     body,
+		})
+	}
+
+	for _, nested := range body.Blocks() {
+		nestedLabel := label + "_" + nested.Type()
+		found = append(found, findLiterals(nested.Body(), nestedLabel, address+"."+nested.Type())...)
+	}
+
+	return found
+}
+
+// literalValue evaluates an attribute that is a string or a list of strings with no references
+func literalValue(attr *hclwrite.Attribute) (cty.Value, bool) {
+	src := attr.Expr().BuildTokens(nil).Bytes()
+	expr, diags := hclsyntax.ParseExpression(src, "", hcl.InitialPos)
+	if diags.HasErrors() || len(expr.Variables()) > 0 {
+		return cty.NilVal, false
+	}
+
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() || !value.IsWhollyKnown() || value.IsNull() {
+		return cty.NilVal, false
+	}
+
+	switch {
+	case value.Type() == cty.String:
+		if anyAddressCIDRs[value.AsString()] {
+			return cty.NilVal, false
+		}
+		return value, true
+	case value.Type().IsTupleType() || value.Type().IsListType():
+		if value.LengthInt() == 0 {
+			return cty.NilVal, false
+		}
+		var items []cty.Value
+		for it := value.ElementIterator(); it.Next(); {
+			_, item := it.Element()
+			if item.Type() != cty.String || anyAddressCIDRs[item.AsString()] {
+				return cty.NilVal, false
+			}
+			items = append(items, item)
+		}
+		return cty.ListVal(items), true
+	}
+
+	return cty.NilVal, false
+}
+
+// valueKey returns a comparable representation of a literal value
+func valueKey(value cty.Value) string {
+	return string(hclwrite.TokensForValue(value).Bytes())
+}
+
+// sanitizeIdentifier makes a string a valid terraform identifier
+func sanitizeIdentifier(name string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteRune('_')
+		}
+	}
+	result := sb.String()
+	if result == "" || (result[0] >= '0' && result[0] <= '9') {
+		result = "v_" + result
+	}
+	return result
+}
+
+// uniqueVariableName returns name, or name with a numeric suffix if it is already taken
+func uniqueVariableName(name string, taken map[string]bool) string {
+	candidate := name
+	for i := 2; taken[candidate]; i++ {
+		candidate = fmt.Sprintf("%s_%d", name, i)
+	}
+	taken[candidate] = true
+	return candidate
+}